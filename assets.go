@@ -0,0 +1,225 @@
+package tokendirectory
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+)
+
+// AssetGraph links the representations of the same asset across chains,
+// eg. USDC on every chain, from the Extensions.BridgeInfo and the
+// Extensions.OriginChainID and OriginAddress of the tokens.
+type AssetGraph struct {
+	assets  []Asset
+	byToken map[TokenKey]int
+	missing []MissingLink
+}
+
+// Asset is a group of tokens representing the same asset on different
+// chains.
+type Asset struct {
+	// Origin is the token the asset originates from, as declared by the
+	// tokens of the asset. It may be missing from the directory, and it is
+	// the zero TokenKey if no token declares an origin.
+	Origin TokenKey
+
+	// Tokens are the tokens of the asset found in the directory, ordered by
+	// chain ID and address.
+	Tokens []ContractInfo
+}
+
+// MissingLink is a link from a token to a token which is missing from the
+// directory.
+type MissingLink struct {
+	From TokenKey
+	To   TokenKey
+
+	// Kind is "bridge" for a link from Extensions.BridgeInfo, and "origin"
+	// for a link from Extensions.OriginChainID and OriginAddress.
+	Kind string
+}
+
+// BuildAssetGraph builds the asset graph of the contract info, as returned
+// by FetchTokenContractInfo. Tokens without any link form an asset of their
+// own.
+func BuildAssetGraph(contractInfo map[uint64][]ContractInfo) *AssetGraph {
+	g := &AssetGraph{byToken: map[TokenKey]int{}}
+
+	// union-find over every token, including the ones which are only
+	// referenced, so tokens linking to the same missing token are still
+	// grouped together
+	parent := map[TokenKey]TokenKey{}
+	var find func(TokenKey) TokenKey
+	find = func(key TokenKey) TokenKey {
+		p, ok := parent[key]
+		if !ok {
+			parent[key] = key
+			return key
+		}
+		if p != key {
+			p = find(p)
+			parent[key] = p
+		}
+		return p
+	}
+	union := func(a, b TokenKey) {
+		ra, rb := find(a), find(b)
+		if ra != rb {
+			// keep the smallest key as the root, for a deterministic graph
+			if compareTokenKeys(rb, ra) < 0 {
+				ra, rb = rb, ra
+			}
+			parent[rb] = ra
+		}
+	}
+
+	tokens := map[TokenKey]ContractInfo{}
+	for _, contractInfos := range contractInfo {
+		for _, ci := range contractInfos {
+			key := tokenKey(ci)
+			tokens[key] = ci
+			find(key)
+		}
+	}
+
+	// origins declared by the tokens, counted per group once all links are
+	// known
+	origins := map[TokenKey]TokenKey{}
+	link := func(from, to TokenKey, kind string) {
+		if _, ok := tokens[to]; !ok {
+			g.missing = append(g.missing, MissingLink{From: from, To: to, Kind: kind})
+		}
+		union(from, to)
+	}
+	for key, ci := range tokens {
+		for chain, bridge := range ci.Extensions.BridgeInfo {
+			chainID, err := strconv.ParseUint(chain, 10, 64)
+			if err != nil || bridge.TokenAddress == "" {
+				// malformed links are not followed
+				continue
+			}
+			to := TokenKey{ChainID: chainID, Address: normalizeAddress(bridge.TokenAddress)}
+			if to != key {
+				link(key, to, "bridge")
+			}
+		}
+		if ci.Extensions.OriginChainID != 0 && ci.Extensions.OriginAddress != "" {
+			origin := TokenKey{ChainID: ci.Extensions.OriginChainID, Address: normalizeAddress(ci.Extensions.OriginAddress)}
+			origins[key] = origin
+			if origin != key {
+				link(key, origin, "origin")
+			}
+		}
+	}
+
+	groups := map[TokenKey]*Asset{}
+	for key, ci := range tokens {
+		root := find(key)
+		if groups[root] == nil {
+			groups[root] = &Asset{}
+		}
+		groups[root].Tokens = append(groups[root].Tokens, ci)
+	}
+
+	// the origin of an asset is the one declared by most of its tokens
+	votes := map[TokenKey]map[TokenKey]int{}
+	for key, origin := range origins {
+		root := find(key)
+		if votes[root] == nil {
+			votes[root] = map[TokenKey]int{}
+		}
+		votes[root][origin]++
+	}
+	for root, asset := range groups {
+		var best TokenKey
+		for origin, n := range votes[root] {
+			if n > votes[root][best] || n == votes[root][best] && compareTokenKeys(origin, best) < 0 {
+				best = origin
+			}
+		}
+		asset.Origin = best
+		slices.SortFunc(asset.Tokens, func(a, b ContractInfo) int {
+			return compareTokenKeys(tokenKey(a), tokenKey(b))
+		})
+		g.assets = append(g.assets, *asset)
+	}
+
+	slices.SortFunc(g.assets, func(a, b Asset) int {
+		return compareTokenKeys(tokenKey(a.Tokens[0]), tokenKey(b.Tokens[0]))
+	})
+	for i, asset := range g.assets {
+		for _, ci := range asset.Tokens {
+			g.byToken[tokenKey(ci)] = i
+		}
+	}
+	slices.SortFunc(g.missing, func(a, b MissingLink) int {
+		if c := compareTokenKeys(a.From, b.From); c != 0 {
+			return c
+		}
+		if c := compareTokenKeys(a.To, b.To); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Kind, b.Kind)
+	})
+	return g
+}
+
+// Assets returns every asset of the graph.
+func (g *AssetGraph) Assets() []Asset {
+	return g.assets
+}
+
+// Asset returns the asset of the token at the given address on the given
+// chain.
+func (g *AssetGraph) Asset(chainID uint64, address string) (Asset, bool) {
+	i, ok := g.byToken[TokenKey{ChainID: chainID, Address: normalizeAddress(address)}]
+	if !ok {
+		return Asset{}, false
+	}
+	return g.assets[i], true
+}
+
+// Origin resolves the token at the given address on the given chain to the
+// token its asset originates from.
+func (g *AssetGraph) Origin(chainID uint64, address string) (TokenKey, bool) {
+	asset, ok := g.Asset(chainID, address)
+	if !ok || asset.Origin == (TokenKey{}) {
+		return TokenKey{}, false
+	}
+	return asset.Origin, true
+}
+
+// MissingLinks returns the links to tokens which are missing from the
+// directory.
+func (g *AssetGraph) MissingLinks() []MissingLink {
+	return g.missing
+}
+
+// AssetGraph returns the asset graph of the tokens of the registry.
+func (r *Registry) AssetGraph() *AssetGraph {
+	state := r.state.Load()
+	if state == nil {
+		return BuildAssetGraph(nil)
+	}
+	return state.assetGraph()
+}
+
+// assetGraph builds the asset graph on first use, as most users of the
+// registry never need it.
+func (s *registryState) assetGraph() *AssetGraph {
+	s.assetsOnce.Do(func() {
+		s.assets = BuildAssetGraph(s.contractInfo)
+	})
+	return s.assets
+}
+
+func tokenKey(ci ContractInfo) TokenKey {
+	return TokenKey{ChainID: ci.ChainID, Address: normalizeAddress(ci.Address)}
+}
+
+func compareTokenKeys(a, b TokenKey) int {
+	if c := cmp.Compare(a.ChainID, b.ChainID); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Address, b.Address)
+}
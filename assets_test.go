@@ -0,0 +1,73 @@
+package tokendirectory
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestAssetGraph(t *testing.T) {
+	var contractInfo map[uint64][]ContractInfo
+	err := json.Unmarshal([]byte(`{
+		"1": [
+			{"chainId": 1, "address": "0xa0b8", "symbol": "USDC", "extensions": {"bridgeInfo": {"137": {"tokenAddress": "0x2791"}}}},
+			{"chainId": 1, "address": "0xdead", "symbol": "SOLO"}
+		],
+		"137": [
+			{"chainId": 137, "address": "0x2791", "symbol": "USDC.e", "extensions": {"originChainId": 1, "originAddress": "0xA0B8"}}
+		],
+		"42161": [
+			{"chainId": 42161, "address": "0xaf88", "symbol": "USDC", "extensions": {"originChainId": 1, "originAddress": "0xa0b8"}},
+			{"chainId": 42161, "address": "0x0bbb", "symbol": "FOO", "extensions": {"originChainId": 10, "originAddress": "0x0aaa"}}
+		],
+		"8453": [
+			{"chainId": 8453, "address": "0x0ccc", "symbol": "FOO", "extensions": {"originChainId": 10, "originAddress": "0x0aaa", "bridgeInfo": {"56": {"tokenAddress": "0x0ddd"}}}}
+		]
+	}`), &contractInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := func(asset Asset) []TokenKey {
+		out := make([]TokenKey, len(asset.Tokens))
+		for i, ci := range asset.Tokens {
+			out[i] = tokenKey(ci)
+		}
+		return out
+	}
+
+	g := BuildAssetGraph(contractInfo)
+	if len(g.Assets()) != 3 {
+		t.Fatalf("expected 3 assets, got %+v", g.Assets())
+	}
+
+	usdc, ok := g.Asset(137, "0x2791")
+	if !ok {
+		t.Fatal("expected USDC.e to be found")
+	}
+	want := []TokenKey{{1, "0xa0b8"}, {137, "0x2791"}, {42161, "0xaf88"}}
+	if !slices.Equal(keys(usdc), want) {
+		t.Fatalf("expected USDC on every chain %v, got %v", want, keys(usdc))
+	}
+	if origin, ok := g.Origin(42161, "0xAF88"); !ok || origin != (TokenKey{1, "0xa0b8"}) {
+		t.Fatalf("unexpected origin: %v %v", origin, ok)
+	}
+
+	// tokens linking to the same missing origin are grouped together
+	foo, _ := g.Asset(8453, "0x0ccc")
+	if !slices.Equal(keys(foo), []TokenKey{{8453, "0x0ccc"}, {42161, "0x0bbb"}}) || foo.Origin != (TokenKey{10, "0x0aaa"}) {
+		t.Fatalf("unexpected asset: %+v", foo)
+	}
+
+	if _, ok := g.Origin(1, "0xdead"); ok {
+		t.Fatal("expected no origin for a token without links")
+	}
+
+	wantMissing := []MissingLink{
+		{From: TokenKey{8453, "0x0ccc"}, To: TokenKey{10, "0x0aaa"}, Kind: "origin"},
+		{From: TokenKey{8453, "0x0ccc"}, To: TokenKey{56, "0x0ddd"}, Kind: "bridge"},
+		{From: TokenKey{42161, "0x0bbb"}, To: TokenKey{10, "0x0aaa"}, Kind: "origin"},
+	}
+	if got := g.MissingLinks(); !slices.Equal(got, wantMissing) {
+		t.Fatalf("expected missing links %+v, got %+v", wantMissing, got)
+	}
+}
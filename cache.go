@@ -0,0 +1,133 @@
+package tokendirectory
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Cache stores decoded token lists, keyed by their token list URL and
+// versioned by their content hash. A cache holds at most one version of a
+// token list per URL, so setting a list with a new content hash replaces
+// the previous one.
+//
+// Cached token lists are stored before any per-directory filtering (eg.
+// Options.ChainIDs) is applied, so a single cache may be shared by several
+// TokenDirectory instances. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the token list cached for tokenListURL, but only if it
+	// was stored with the given content hash.
+	Get(ctx context.Context, tokenListURL string, contentHash string) (TokenList, bool, error)
+
+	// Set stores the token list for tokenListURL with the given content
+	// hash, replacing any previously cached version.
+	Set(ctx context.Context, tokenListURL string, contentHash string, tokenList TokenList) error
+
+	// Delete removes the token list cached for tokenListURL, if any.
+	Delete(ctx context.Context, tokenListURL string) error
+}
+
+type cacheEntry struct {
+	tokenListURL string
+	contentHash  string
+	tokenList    TokenList
+}
+
+// NewMemoryCache returns an unbounded in-memory Cache. It is the default
+// cache used by a TokenDirectory.
+func NewMemoryCache() Cache {
+	return &memoryCache{entries: map[string]cacheEntry{}}
+}
+
+type memoryCache struct {
+	entries map[string]cacheEntry
+	mu      sync.Mutex
+}
+
+func (c *memoryCache) Get(_ context.Context, tokenListURL string, contentHash string) (TokenList, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[tokenListURL]
+	if !ok || entry.contentHash != contentHash {
+		return TokenList{}, false, nil
+	}
+	return entry.tokenList, true, nil
+}
+
+func (c *memoryCache) Set(_ context.Context, tokenListURL string, contentHash string, tokenList TokenList) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[tokenListURL] = cacheEntry{tokenListURL: tokenListURL, contentHash: contentHash, tokenList: tokenList}
+	return nil
+}
+
+func (c *memoryCache) Delete(_ context.Context, tokenListURL string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, tokenListURL)
+	return nil
+}
+
+// NewLRUCache returns an in-memory Cache which holds at most size token
+// lists, evicting the least recently used one when full. A size of zero or
+// less is treated as one.
+func NewLRUCache(size int) Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &lruCache{
+		size:     size,
+		order:    list.New(),
+		elements: map[string]*list.Element{},
+	}
+}
+
+type lruCache struct {
+	size     int
+	order    *list.List // front is the most recently used
+	elements map[string]*list.Element
+	mu       sync.Mutex
+}
+
+func (c *lruCache) Get(_ context.Context, tokenListURL string, contentHash string) (TokenList, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.elements[tokenListURL]
+	if !ok {
+		return TokenList{}, false, nil
+	}
+	entry := el.Value.(cacheEntry)
+	if entry.contentHash != contentHash {
+		return TokenList{}, false, nil
+	}
+	c.order.MoveToFront(el)
+	return entry.tokenList, true, nil
+}
+
+func (c *lruCache) Set(_ context.Context, tokenListURL string, contentHash string, tokenList TokenList) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := cacheEntry{tokenListURL: tokenListURL, contentHash: contentHash, tokenList: tokenList}
+	if el, ok := c.elements[tokenListURL]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.elements[tokenListURL] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.elements, oldest.Value.(cacheEntry).tokenListURL)
+	}
+	return nil
+}
+
+func (c *lruCache) Delete(_ context.Context, tokenListURL string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.elements[tokenListURL]; ok {
+		c.order.Remove(el)
+		delete(c.elements, tokenListURL)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package tokendirectory
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// remoteCache is a stand-in for a shared store such as Redis: token lists
+// are serialized on Set, so anything not part of the JSON is lost.
+type remoteCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+	gets    int
+}
+
+func newRemoteCache() *remoteCache {
+	return &remoteCache{entries: map[string][]byte{}}
+}
+
+func (c *remoteCache) Get(_ context.Context, tokenListURL string, contentHash string) (TokenList, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gets++
+	buf, ok := c.entries[tokenListURL+"#"+contentHash]
+	if !ok {
+		return TokenList{}, false, nil
+	}
+	var tokenList TokenList
+	if err := json.Unmarshal(buf, &tokenList); err != nil {
+		return TokenList{}, false, err
+	}
+	return tokenList, true, nil
+}
+
+func (c *remoteCache) Set(_ context.Context, tokenListURL string, contentHash string, tokenList TokenList) error {
+	buf, err := json.Marshal(tokenList)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[tokenListURL+"#"+contentHash] = buf
+	return nil
+}
+
+func (c *remoteCache) Delete(_ context.Context, tokenListURL string) error {
+	return nil
+}
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache()
+	_ = c.Set(ctx, "a", "hash1", TokenList{Name: "A"})
+
+	if tokenList, ok, _ := c.Get(ctx, "a", "hash1"); !ok || tokenList.Name != "A" {
+		t.Fatalf("expected cache hit, got %v %+v", ok, tokenList)
+	}
+	if _, ok, _ := c.Get(ctx, "a", "hash2"); ok {
+		t.Fatal("expected miss for a different content hash")
+	}
+
+	_ = c.Set(ctx, "a", "hash2", TokenList{Name: "A2"})
+	if _, ok, _ := c.Get(ctx, "a", "hash1"); ok {
+		t.Fatal("expected the previous version to be replaced")
+	}
+
+	_ = c.Delete(ctx, "a")
+	if _, ok, _ := c.Get(ctx, "a", "hash2"); ok {
+		t.Fatal("expected miss after delete")
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(2)
+	_ = c.Set(ctx, "a", "h", TokenList{Name: "A"})
+	_ = c.Set(ctx, "b", "h", TokenList{Name: "B"})
+
+	// touch a, so b becomes the least recently used
+	if _, ok, _ := c.Get(ctx, "a", "h"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	_ = c.Set(ctx, "c", "h", TokenList{Name: "C"})
+
+	if _, ok, _ := c.Get(ctx, "b", "h"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(ctx, key, "h"); !ok {
+			t.Fatalf("expected %s to be cached", key)
+		}
+	}
+}
+
+func TestCustomCache(t *testing.T) {
+	ctx := context.Background()
+	primary := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.json" {
+			_, _ = w.Write([]byte(testIndexJSON))
+			return
+		}
+		_, _ = w.Write([]byte(testTokenListJSON))
+	})
+	defer primary.Close()
+	fallback := newTestServer(t, http.StatusInternalServerError, "")
+	defer fallback.Close()
+	sources := testSources(primary, fallback)
+
+	url := sources[0].TokenListURL("mainnet", "erc20.json")
+	cache := newRemoteCache()
+
+	// two directories sharing the store only fetch the token list once
+	for i := 0; i < 2; i++ {
+		td := NewTokenDirectory(Options{Sources: sources, Cache: cache})
+		tokenList, err := td.FetchTokenList(ctx, url)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tokenList.TokenListURL != url || tokenList.ContentHash != sha256Hash([]byte(testTokenListJSON)) {
+			t.Fatalf("expected token list metadata to be restored, got %q %q", tokenList.TokenListURL, tokenList.ContentHash)
+		}
+	}
+	listHits := 0
+	for _, path := range primary.requestPaths() {
+		if path == "/mainnet/erc20.json" {
+			listHits++
+		}
+	}
+	if listHits != 1 {
+		t.Fatalf("expected token list to be fetched once, got %d", listHits)
+	}
+
+	t.Run("no cache", func(t *testing.T) {
+		gets := cache.gets
+		td := NewTokenDirectory(Options{Sources: sources, Cache: cache, NoCache: true})
+		if _, err := td.FetchTokenList(ctx, url); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cache.gets != gets {
+			t.Fatal("expected NoCache to bypass the cache")
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package tokendirectory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+)
+
+// ChainInfo describes a chain of the token directory.
+type ChainInfo struct {
+	ChainID uint64
+
+	// Name is the name of the index group of the chain, eg. "mainnet" or
+	// "polygon".
+	Name string
+
+	Deprecated bool
+
+	// TokenLists are the filenames of the token lists of the chain, eg.
+	// "erc20.json", in alphabetical order.
+	TokenLists []string
+}
+
+// Chains returns every chain known to the token directory, ordered by
+// chain ID, regardless of the options filtering the index. The external
+// token lists, which are not tied to a chain, are left out.
+func (d *TokenDirectory) Chains(ctx context.Context) ([]ChainInfo, error) {
+	if _, err := d.fetchIndex(ctx); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	indexFile := d.indexFile
+	d.mu.Unlock()
+
+	chains := []ChainInfo{}
+	for name, group := range indexFile.Index {
+		if name == "_external" || group.ChainID == 0 {
+			continue
+		}
+		tokenLists := make([]string, 0, len(group.TokenLists))
+		for file := range group.TokenLists {
+			tokenLists = append(tokenLists, file)
+		}
+		slices.Sort(tokenLists)
+		chains = append(chains, ChainInfo{
+			ChainID:    group.ChainID,
+			Name:       name,
+			Deprecated: group.Deprecated,
+			TokenLists: tokenLists,
+		})
+	}
+	slices.SortFunc(chains, func(a, b ChainInfo) int {
+		if c := cmp.Compare(a.ChainID, b.ChainID); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return chains, nil
+}
@@ -0,0 +1,43 @@
+package tokendirectory
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestChains(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t, http.StatusOK, `{
+  "index": {
+    "polygon": {"chainId": 137, "tokenLists": {"erc721.json": "a", "erc20.json": "b"}},
+    "mainnet": {"chainId": 1, "tokenLists": {"erc20.json": "c"}},
+    "goerli": {"chainId": 5, "deprecated": true, "tokenLists": {"erc20.json": "d"}},
+    "_external": {"chainId": 0, "tokenLists": {"coingecko.json": "e"}}
+  }
+}`)
+	defer server.Close()
+
+	// the catalog is not narrowed down by the options filtering the index
+	td := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(server.URL, nil)}, ChainIDs: []uint64{1}})
+	chains, err := td.Chains(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []ChainInfo{
+		{ChainID: 1, Name: "mainnet", TokenLists: []string{"erc20.json"}},
+		{ChainID: 5, Name: "goerli", Deprecated: true, TokenLists: []string{"erc20.json"}},
+		{ChainID: 137, Name: "polygon", TokenLists: []string{"erc20.json", "erc721.json"}},
+	}
+	if !slices.EqualFunc(chains, want, func(a, b ChainInfo) bool {
+		return a.ChainID == b.ChainID && a.Name == b.Name && a.Deprecated == b.Deprecated && slices.Equal(a.TokenLists, b.TokenLists)
+	}) {
+		t.Fatalf("expected %+v, got %+v", want, chains)
+	}
+
+	index := mustFetchIndex(t, td)
+	if index[1][0].Group != "mainnet" || index[0][0].Group != "_external" {
+		t.Fatalf("expected the index entries to keep their group, got %+v", index)
+	}
+}
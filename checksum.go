@@ -0,0 +1,110 @@
+package tokendirectory
+
+import (
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// ChecksumAddress returns the EIP-55 mixed-case checksum form of the
+// address, for display.
+func ChecksumAddress(address string) (string, error) {
+	if !addressPattern.MatchString(address) {
+		return "", fmt.Errorf("tokendirectory: invalid address %q", address)
+	}
+	lower := strings.ToLower(address[2:])
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(lower))
+	hashHex := hex.EncodeToString(hash.Sum(nil))
+
+	out := []byte("0x" + lower)
+	for i := range lower {
+		// letters are uppercased when the matching nibble of the hash of
+		// the lowercase address is 8 or more
+		if c := lower[i]; c >= 'a' && c <= 'f' && hashHex[i] >= '8' {
+			out[i+2] = c - 'a' + 'A'
+		}
+	}
+	return string(out), nil
+}
+
+// ValidChecksum reports whether the address matches its EIP-55 checksum.
+// Addresses which are all lowercase or all uppercase carry no checksum, and
+// are valid.
+func ValidChecksum(address string) bool {
+	checksummed, err := ChecksumAddress(address)
+	if err != nil {
+		return false
+	}
+	digits := address[2:]
+	if digits == strings.ToLower(digits) || digits == strings.ToUpper(digits) {
+		return true
+	}
+	return address == checksummed
+}
+
+// ChecksumAddress returns the EIP-55 checksum form of the address of the
+// token, for display, or the address as is if it is not valid.
+func (ci ContractInfo) ChecksumAddress() string {
+	return checksumOrSelf(ci.Address)
+}
+
+// Checksummed returns a copy of the token with its addresses in their
+// EIP-55 checksum form, for display: the address of the token, the token
+// addresses of its BridgeInfo, and its OriginAddress.
+func (ci ContractInfo) Checksummed() ContractInfo {
+	ci.Address = checksumOrSelf(ci.Address)
+	if ci.Extensions.BridgeInfo != nil {
+		bridgeInfo := maps.Clone(ci.Extensions.BridgeInfo)
+		for chainID, bridge := range bridgeInfo {
+			bridge.TokenAddress = checksumOrSelf(bridge.TokenAddress)
+			bridgeInfo[chainID] = bridge
+		}
+		ci.Extensions.BridgeInfo = bridgeInfo
+	}
+	if ci.Extensions.OriginAddress != "" {
+		ci.Extensions.OriginAddress = checksumOrSelf(ci.Extensions.OriginAddress)
+	}
+	return ci
+}
+
+func checksumOrSelf(address string) string {
+	if checksummed, err := ChecksumAddress(address); err == nil {
+		return checksummed
+	}
+	return address
+}
+
+// VerifyChecksums checks the mixed-case addresses of the token list against
+// their EIP-55 checksum, including the token addresses of the BridgeInfo
+// and the OriginAddress of the tokens, and returns the mismatches found,
+// if any. It must be given the token list as published, before its
+// addresses are lowercased.
+func VerifyChecksums(tokenList TokenList) []SchemaViolation {
+	var violations []SchemaViolation
+	for i, token := range tokenList.Tokens {
+		check := func(field, address string) {
+			// malformed addresses are reported by ValidateTokenList
+			if addressPattern.MatchString(address) && !ValidChecksum(address) {
+				checksummed, _ := ChecksumAddress(address)
+				violations = append(violations, SchemaViolation{
+					Token:   i,
+					Address: token.Address,
+					Field:   field,
+					Message: fmt.Sprintf("checksum mismatch, expected %s", checksummed),
+				})
+			}
+		}
+
+		check("address", token.Address)
+		for _, chainID := range slices.Sorted(maps.Keys(token.Extensions.BridgeInfo)) {
+			check("extensions.bridgeInfo."+chainID+".tokenAddress", token.Extensions.BridgeInfo[chainID].TokenAddress)
+		}
+		check("extensions.originAddress", token.Extensions.OriginAddress)
+	}
+	return violations
+}
@@ -0,0 +1,107 @@
+package tokendirectory
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// test vectors from EIP-55
+var checksummedAddresses = []string{
+	"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+	"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+	"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+	"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+}
+
+func TestChecksumAddress(t *testing.T) {
+	for _, want := range checksummedAddresses {
+		got, err := ChecksumAddress(strings.ToLower(want))
+		if err != nil || got != want {
+			t.Fatalf("expected %s, got %s %v", want, got, err)
+		}
+		if !ValidChecksum(want) || !ValidChecksum(strings.ToLower(want)) || !ValidChecksum("0x"+strings.ToUpper(want[2:])) {
+			t.Fatalf("expected %s to be valid", want)
+		}
+		if ValidChecksum(strings.Replace(want, "a", "A", 1)) {
+			t.Fatalf("expected a wrong checksum of %s to be invalid", want)
+		}
+	}
+	if _, err := ChecksumAddress("0x123"); err == nil {
+		t.Fatal("expected an invalid address to be rejected")
+	}
+}
+
+func TestChecksummedContractInfo(t *testing.T) {
+	ci := ContractInfo{Address: strings.ToLower(checksummedAddresses[0])}
+	ci.Extensions.OriginAddress = strings.ToLower(checksummedAddresses[1])
+	ci.Extensions.BridgeInfo = map[string]struct {
+		TokenAddress string `json:"tokenAddress"`
+	}{"137": {TokenAddress: strings.ToLower(checksummedAddresses[2])}}
+
+	if got := ci.ChecksumAddress(); got != checksummedAddresses[0] {
+		t.Fatalf("unexpected checksum address: %s", got)
+	}
+	checksummed := ci.Checksummed()
+	if checksummed.Address != checksummedAddresses[0] || checksummed.Extensions.OriginAddress != checksummedAddresses[1] || checksummed.Extensions.BridgeInfo["137"].TokenAddress != checksummedAddresses[2] {
+		t.Fatalf("unexpected checksummed contract info: %+v", checksummed)
+	}
+	if ci.Extensions.BridgeInfo["137"].TokenAddress != strings.ToLower(checksummedAddresses[2]) {
+		t.Fatal("expected the original contract info to be left untouched")
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	ctx := context.Background()
+	wrong := strings.Replace(checksummedAddresses[0], "a", "A", 1)
+	tokenListJSON := `{"name":"Test","chainId":1,"timestamp":"2024-01-01T00:00:00Z","version":{"major":1,"minor":0,"patch":0},"tokens":[
+		{"chainId":1,"address":"` + checksummedAddresses[0] + `","name":"Good","symbol":"GOOD","decimals":18},
+		{"chainId":1,"address":"` + wrong + `","name":"Bad","symbol":"BAD","decimals":18,
+		 "extensions":{"originAddress":"` + wrong + `","bridgeInfo":{"10":{"tokenAddress":"` + checksummedAddresses[1] + `"}}}}
+	]}`
+	server := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(tokenListJSON))
+	})
+	defer server.Close()
+
+	td := NewTokenDirectory(Options{SchemaValidation: SchemaValidationReport, VerifyChecksums: true})
+	tokenList, err := td.FetchTokenList(ctx, server.URL+"/list.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	violations := tokenList.SchemaViolations
+	if len(violations) != 2 || violations[0].Field != "address" || violations[1].Field != "extensions.originAddress" || violations[0].Token != 1 {
+		t.Fatalf("expected the mismatches of the second token, got %+v", violations)
+	}
+	if !strings.Contains(violations[0].Message, checksummedAddresses[0]) {
+		t.Fatalf("expected the checksummed address in the message, got %q", violations[0].Message)
+	}
+	if tokenList.Tokens[1].Address != strings.ToLower(wrong) {
+		t.Fatalf("expected the addresses to still be lowercased, got %s", tokenList.Tokens[1].Address)
+	}
+
+	td = NewTokenDirectory(Options{SchemaValidation: SchemaValidationReject, VerifyChecksums: true})
+	var schemaErr *SchemaError
+	if _, err := td.FetchTokenList(ctx, server.URL+"/list.json"); !errors.As(err, &schemaErr) {
+		t.Fatalf("expected the token list to be rejected, got: %v", err)
+	}
+
+	// the violations are not lost by a cache which drops them
+	dir := newTestDirectory(map[string]string{"1/erc20.json": tokenListJSON})
+	dirServer := newHandlerTestServer(t, dir.handler)
+	defer dirServer.Close()
+	cache := newRemoteCache()
+	td = NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(dirServer.URL, nil)}, Cache: cache, SchemaValidation: SchemaValidationReport, VerifyChecksums: true})
+	for range 2 {
+		tokenList, err := td.FetchTokenList(ctx, td.TokenListURL("1", "erc20.json"))
+		if err != nil || len(tokenList.SchemaViolations) != 2 {
+			t.Fatalf("expected the mismatches of the second token, got %+v: %v", tokenList.SchemaViolations, err)
+		}
+	}
+	td = NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(dirServer.URL, nil)}, Cache: cache, SchemaValidation: SchemaValidationReject, VerifyChecksums: true})
+	if _, err := td.FetchTokenList(ctx, td.TokenListURL("1", "erc20.json")); !errors.As(err, &schemaErr) {
+		t.Fatalf("expected the cached token list to be rejected, got: %v", err)
+	}
+}
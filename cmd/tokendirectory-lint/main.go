@@ -0,0 +1,96 @@
+// Command tokendirectory-lint lints token lists before they are published
+// to the token directory. Given token list files, it lints each of them.
+// Without arguments, it lints the whole token directory.
+//
+// It exits with status 1 when issues are found, and 2 on errors.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xsequence/go-tokendirectory"
+)
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "print the report as JSON")
+	chains := flag.String("chains", "", "comma separated list of chain IDs to lint, when linting the token directory, default is all chains")
+	timeout := flag.Duration("timeout", 5*time.Minute, "overall timeout")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [token list files...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var report tokendirectory.LintReport
+	var err error
+	if flag.NArg() > 0 {
+		report, err = lintFiles(flag.Args())
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		report, err = lintDirectory(ctx, *chains)
+	}
+	if err != nil {
+		log.Print(err)
+		os.Exit(2)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Print(err)
+			os.Exit(2)
+		}
+	} else {
+		fmt.Print(report)
+	}
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
+
+func lintFiles(files []string) (tokendirectory.LintReport, error) {
+	report := tokendirectory.LintReport{Issues: []tokendirectory.LintIssue{}}
+	for _, file := range files {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			return tokendirectory.LintReport{}, err
+		}
+		var tokenList tokendirectory.TokenList
+		if err := json.Unmarshal(buf, &tokenList); err != nil {
+			return tokendirectory.LintReport{}, fmt.Errorf("%s: %w", file, err)
+		}
+		tokenList.TokenListURL = file
+		report.Issues = append(report.Issues, tokendirectory.LintTokenList(tokenList).Issues...)
+	}
+	return report, nil
+}
+
+func lintDirectory(ctx context.Context, chains string) (tokendirectory.LintReport, error) {
+	var chainIDs []uint64
+	if chains != "" {
+		for _, s := range strings.Split(chains, ",") {
+			chainID, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				return tokendirectory.LintReport{}, fmt.Errorf("invalid chain ID %q: %w", s, err)
+			}
+			chainIDs = append(chainIDs, chainID)
+		}
+	}
+
+	td := tokendirectory.NewTokenDirectory(tokendirectory.Options{ChainIDs: chainIDs})
+	index, err := td.FetchIndex(ctx)
+	if err != nil {
+		return tokendirectory.LintReport{}, err
+	}
+	return td.LintIndex(ctx, index)
+}
@@ -0,0 +1,170 @@
+// Command tokendirectory-snapshot downloads the token directory index and
+// token lists into a directory laid out like the token-directory repository,
+// ie. with index/index.json and index/<group>/<file>. It is used to refresh
+// the snapshot embedded by the snapshot package.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xsequence/go-tokendirectory"
+)
+
+type indexFile struct {
+	Index map[string]indexGroup `json:"index"`
+}
+
+type indexGroup struct {
+	ChainID    uint64            `json:"chainId"`
+	Deprecated bool              `json:"deprecated"`
+	TokenLists map[string]string `json:"tokenLists"`
+}
+
+func main() {
+	out := flag.String("out", "snapshot", "directory to write the snapshot to, the index is written to <out>/index")
+	chains := flag.String("chains", "", "comma separated list of chain IDs to include, default is all chains")
+	skipExternal := flag.Bool("skip-external", false, "skip the external token lists")
+	includeDeprecated := flag.Bool("include-deprecated", false, "include the deprecated chains")
+	timeout := flag.Duration("timeout", 5*time.Minute, "overall timeout")
+	flag.Parse()
+
+	var chainIDs []uint64
+	if *chains != "" {
+		for _, s := range strings.Split(*chains, ",") {
+			chainID, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				log.Fatalf("invalid chain ID %q: %v", s, err)
+			}
+			chainIDs = append(chainIDs, chainID)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	sources := tokendirectory.DefaultSources(nil)
+	filter := func(name string, group indexGroup) bool {
+		if name == "_external" {
+			return !*skipExternal
+		}
+		if group.Deprecated && !*includeDeprecated {
+			return false
+		}
+		return len(chainIDs) == 0 || slices.Contains(chainIDs, group.ChainID)
+	}
+	if err := run(ctx, sources, *out, filter); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, sources []tokendirectory.Source, out string, filter func(string, indexGroup) bool) error {
+	buf, err := fetch(sources, func(source tokendirectory.Source) ([]byte, error) {
+		return source.FetchIndex(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("fetching index: %w", err)
+	}
+	var index indexFile
+	if err := json.Unmarshal(buf, &index); err != nil {
+		return fmt.Errorf("unmarshalling index: %w", err)
+	}
+
+	// write to a temporary directory first, so a failure leaves the
+	// previous snapshot untouched
+	tmp := filepath.Join(out, "index.tmp")
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	snapshot := indexFile{Index: map[string]indexGroup{}}
+	for name, group := range index.Index {
+		if !filter(name, group) {
+			continue
+		}
+		if !validPathElement(name) {
+			return fmt.Errorf("invalid index group %q", name)
+		}
+		for file, hash := range group.TokenLists {
+			if !validPathElement(file) {
+				return fmt.Errorf("invalid token list file %q", file)
+			}
+			buf, err := fetch(sources, func(source tokendirectory.Source) ([]byte, error) {
+				buf, err := source.FetchTokenList(ctx, name, file)
+				if err == nil && sha256Hash(buf) != hash {
+					err = fmt.Errorf("content hash mismatch: expected %s, got %s", hash, sha256Hash(buf))
+				}
+				return buf, err
+			})
+			if err != nil {
+				return fmt.Errorf("fetching token list %s/%s: %w", name, file, err)
+			}
+			if err := writeFile(filepath.Join(tmp, name, file), buf); err != nil {
+				return err
+			}
+			log.Printf("%s/%s: %d bytes", name, file, len(buf))
+		}
+		snapshot.Index[name] = group
+	}
+
+	if len(snapshot.Index) == 0 {
+		// an empty snapshot is useless as a last resort, keep the previous one
+		return errors.New("no token lists to snapshot")
+	}
+
+	buf, err = json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling index: %w", err)
+	}
+	if err := writeFile(filepath.Join(tmp, "index.json"), append(buf, '\n')); err != nil {
+		return err
+	}
+
+	dst := filepath.Join(out, "index")
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// fetch calls fn with each source in order, until one succeeds.
+func fetch(sources []tokendirectory.Source, fn func(tokendirectory.Source) ([]byte, error)) ([]byte, error) {
+	var errs []error
+	for _, source := range sources {
+		buf, err := fn(source)
+		if err == nil {
+			return buf, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+func writeFile(path string, buf []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf, 0o644)
+}
+
+func validPathElement(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func sha256Hash(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,114 @@
+package tokendirectory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// diskCache persists the raw index and token list bodies in a directory so
+// they survive process restarts. Token lists are stored by URL and content
+// hash, and are verified against that hash when read back.
+//
+// Files are written to a temporary file and renamed into place, so several
+// processes may share the same directory: readers either see a complete
+// file or no file at all.
+type diskCache struct {
+	dir string
+}
+
+func newDiskCache(dir string) *diskCache {
+	return &diskCache{dir: dir}
+}
+
+func (c *diskCache) indexPath() string {
+	return filepath.Join(c.dir, "index.json")
+}
+
+func (c *diskCache) tokenListPrefix(tokenListURL string) string {
+	return filepath.Join(c.dir, "lists", sha256Hash([]byte(tokenListURL)))
+}
+
+func (c *diskCache) tokenListPath(tokenListURL string, contentHash string) string {
+	return fmt.Sprintf("%s-%s.json", c.tokenListPrefix(tokenListURL), contentHash)
+}
+
+// readIndex returns the persisted index body if it was written less than
+// maxAge ago, along with the time it was written.
+func (c *diskCache) readIndex(maxAge time.Duration) ([]byte, time.Time, bool) {
+	info, err := os.Stat(c.indexPath())
+	if err != nil || time.Since(info.ModTime()) >= maxAge {
+		return nil, time.Time{}, false
+	}
+	buf, err := os.ReadFile(c.indexPath())
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	return buf, info.ModTime(), true
+}
+
+func (c *diskCache) writeIndex(buf []byte) error {
+	return writeFileAtomic(c.indexPath(), buf)
+}
+
+// readTokenList returns the persisted token list body for the given URL and
+// content hash. Entries whose body no longer matches the hash (eg. a
+// truncated or tampered file) are ignored.
+func (c *diskCache) readTokenList(tokenListURL string, contentHash string) ([]byte, bool) {
+	if contentHash == "" {
+		return nil, false
+	}
+	buf, err := os.ReadFile(c.tokenListPath(tokenListURL, contentHash))
+	if err != nil {
+		return nil, false
+	}
+	if sha256Hash(buf) != contentHash {
+		return nil, false
+	}
+	return buf, true
+}
+
+// writeTokenList persists the token list body and removes any entries for
+// the same URL with a different content hash, as they are now outdated.
+func (c *diskCache) writeTokenList(tokenListURL string, contentHash string, buf []byte) error {
+	path := c.tokenListPath(tokenListURL, contentHash)
+	if err := writeFileAtomic(path, buf); err != nil {
+		return err
+	}
+	outdated, _ := filepath.Glob(c.tokenListPrefix(tokenListURL) + "-*.json")
+	for _, p := range outdated {
+		if p != path {
+			// another process may have removed it already
+			_ = os.Remove(p)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes buf to a temporary file in the same directory as
+// path and renames it into place.
+func writeFileAtomic(path string, buf []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating cache dir: %w", err)
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	tmp := f.Name()
+	_, err = f.Write(buf)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("writing %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("renaming %s: %w", tmp, err)
+	}
+	return nil
+}
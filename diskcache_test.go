@@ -0,0 +1,89 @@
+package tokendirectory
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskCacheSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	primary := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.json" {
+			_, _ = w.Write([]byte(testIndexJSON))
+			return
+		}
+		_, _ = w.Write([]byte(testTokenListJSON))
+	})
+	defer primary.Close()
+	fallback := newTestServer(t, http.StatusInternalServerError, "")
+	defer fallback.Close()
+	sources := testSources(primary, fallback)
+
+	dir := t.TempDir()
+	url := sources[0].TokenListURL("mainnet", "erc20.json")
+
+	td := NewTokenDirectory(Options{Sources: sources, CacheDir: dir})
+	if _, err := td.FetchTokenList(ctx, url); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hits := primary.hitCount()
+
+	// a new instance sharing the cache dir should not hit the network
+	restarted := NewTokenDirectory(Options{Sources: testSources(primary, fallback), CacheDir: dir})
+	tokenList, err := restarted.FetchTokenList(ctx, url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokenList.Tokens) != 1 || tokenList.ContentHash != sha256Hash([]byte(testTokenListJSON)) {
+		t.Fatalf("unexpected cached token list: %+v", tokenList)
+	}
+	if primary.hitCount() != hits {
+		t.Fatalf("expected no requests after restart, got %d", primary.hitCount()-hits)
+	}
+}
+
+func TestDiskCacheTokenList(t *testing.T) {
+	c := newDiskCache(t.TempDir())
+	url := "https://example.com/list.json"
+	body := []byte(testTokenListJSON)
+	hash := sha256Hash(body)
+
+	if _, ok := c.readTokenList(url, hash); ok {
+		t.Fatal("expected empty cache")
+	}
+	if err := c.writeTokenList(url, hash, body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf, ok := c.readTokenList(url, hash); !ok || string(buf) != string(body) {
+		t.Fatalf("expected cached body, got %q", buf)
+	}
+	if _, ok := c.readTokenList(url, "other-hash"); ok {
+		t.Fatal("expected miss for a different content hash")
+	}
+
+	// a newer version of the list replaces the outdated one
+	newBody := []byte(`{"name":"New List","tokens":[]}`)
+	newHash := sha256Hash(newBody)
+	if err := c.writeTokenList(url, newHash, newBody); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(c.tokenListPath(url, hash)); !os.IsNotExist(err) {
+		t.Fatalf("expected outdated entry to be removed, got: %v", err)
+	}
+
+	// a corrupted entry must not be served
+	if err := os.WriteFile(c.tokenListPath(url, newHash), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.readTokenList(url, newHash); ok {
+		t.Fatal("expected corrupted entry to be ignored")
+	}
+
+	entries, _ := filepath.Glob(filepath.Join(c.dir, "lists", "*.tmp"))
+	if len(entries) != 0 {
+		t.Fatalf("expected no leftover temp files, got %v", entries)
+	}
+}
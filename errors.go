@@ -0,0 +1,205 @@
+package tokendirectory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrAllSourcesFailed is reported (wrapped) when every source failed,
+	// along with the *SourceError of each source.
+	ErrAllSourcesFailed = errors.New("all sources failed")
+
+	// ErrSourceTimeout is reported (wrapped) when a single source exceeds
+	// sourceAttemptTimeout while the caller's context is still alive. It lets
+	// callers distinguish "the source was slow" (safe to retry) from the
+	// caller's own context deadline expiring.
+	ErrSourceTimeout = errors.New("source timed out")
+)
+
+// sourceTimeoutError is a source exceeding sourceAttemptTimeout. It wraps
+// ErrSourceTimeout and the last status of the attempt, and records its
+// retries, but does not wrap the attempt's context.DeadlineExceeded, which
+// callers would mistake for their own deadline.
+type sourceTimeoutError struct {
+	err       error
+	attempts  int
+	statusErr *httpStatusError
+}
+
+func newSourceTimeoutError(err error) *sourceTimeoutError {
+	timeoutErr := &sourceTimeoutError{err: err, attempts: 1}
+	var attemptsErr *attemptsError
+	if errors.As(err, &attemptsErr) {
+		timeoutErr.attempts = attemptsErr.attempts
+	}
+	errors.As(err, &timeoutErr.statusErr)
+	return timeoutErr
+}
+
+func (e *sourceTimeoutError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrSourceTimeout, e.err)
+}
+
+func (e *sourceTimeoutError) Unwrap() []error {
+	if e.statusErr == nil {
+		return []error{ErrSourceTimeout}
+	}
+	return []error{ErrSourceTimeout, e.statusErr}
+}
+
+// SourceError is the failure of a fetch from a single source.
+type SourceError struct {
+	// URL is the URL fetched from the source.
+	URL string
+
+	// StatusCode is the status code of an unexpected response, or 0 if the
+	// source failed otherwise, eg. on a network error or an invalid
+	// response.
+	StatusCode int
+
+	// Attempt is the number of attempts made to the source, more than one
+	// if the request was retried.
+	Attempt int
+
+	Err error
+}
+
+func (e *SourceError) Error() string {
+	if e.Attempt > 1 {
+		return fmt.Sprintf("fetching %s: %v (attempt %d)", e.URL, e.Err, e.Attempt)
+	}
+	return fmt.Sprintf("fetching %s: %v", e.URL, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+func newSourceError(url string, err error) *SourceError {
+	sourceErr := &SourceError{URL: url, Attempt: 1, Err: err}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		sourceErr.StatusCode = statusErr.statusCode
+	}
+	var attemptsErr *attemptsError
+	var timeoutErr *sourceTimeoutError
+	if errors.As(err, &attemptsErr) {
+		sourceErr.Attempt = attemptsErr.attempts
+	} else if errors.As(err, &timeoutErr) {
+		sourceErr.Attempt = timeoutErr.attempts
+	}
+	return sourceErr
+}
+
+// ValidationError is reported (wrapped in a *SourceError) when a source
+// responded with an index or a token list which is not valid.
+type ValidationError struct {
+	URL string
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("validating response: %v", e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// HashMismatchError is reported (wrapped in a *ValidationError) when a
+// token list does not match the content hash of the index.
+type HashMismatchError struct {
+	URL      string
+	Expected string
+	Got      string
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("content hash mismatch: expected %s, got %s", e.Expected, e.Got)
+}
+
+// VersionDowngradeError is reported (wrapped in a *ValidationError) when
+// Options.RejectVersionDowngrades is set and a token list has a lower
+// version than the one last fetched from its URL.
+type VersionDowngradeError struct {
+	URL    string
+	Cached Version
+	Got    Version
+}
+
+func (e *VersionDowngradeError) Error() string {
+	return fmt.Sprintf("token list version downgrade: cached %s, got %s", e.Cached, e.Got)
+}
+
+// PartialError is returned along with the token lists which could be
+// fetched, when Options.AllowPartialResults is set and some token lists
+// failed.
+type PartialError struct {
+	Failures []TokenListFailure
+}
+
+// TokenListFailure reports why a token list could not be fetched.
+type TokenListFailure struct {
+	URL     string
+	ChainID uint64
+
+	// Err is the error of the token list, including the errors of every
+	// source.
+	Err error
+
+	// SourceErrors are the errors of each source which was tried, in the
+	// order they were tried.
+	SourceErrors []*SourceError
+
+	// HashMismatch reports whether a source served a token list which did
+	// not match the content hash of the index.
+	HashMismatch bool
+}
+
+func (e *PartialError) Error() string {
+	urls := make([]string, len(e.Failures))
+	for i, failure := range e.Failures {
+		urls[i] = failure.URL
+	}
+	return fmt.Sprintf("tokendirectory: failed to fetch %d token lists: %s", len(e.Failures), strings.Join(urls, ", "))
+}
+
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, failure := range e.Failures {
+		errs[i] = failure.Err
+	}
+	return errs
+}
+
+func newTokenListFailure(entry TokenDirectoryIndexEntry, err error) TokenListFailure {
+	return TokenListFailure{
+		URL:          entry.TokenListURL,
+		ChainID:      entry.ChainID,
+		Err:          err,
+		SourceErrors: sourceErrors(err),
+		HashMismatch: errors.As(err, new(*HashMismatchError)),
+	}
+}
+
+// sourceErrors returns the errors of each source found in the error tree.
+func sourceErrors(err error) []*SourceError {
+	var errs []*SourceError
+	var walk func(error)
+	walk = func(err error) {
+		switch err := err.(type) {
+		case *SourceError:
+			errs = append(errs, err)
+		case interface{ Unwrap() []error }:
+			for _, err := range err.Unwrap() {
+				walk(err)
+			}
+		case interface{ Unwrap() error }:
+			walk(err.Unwrap())
+		}
+	}
+	walk(err)
+	return errs
+}
@@ -0,0 +1,86 @@
+package tokendirectory
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTypedErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("status codes and attempts", func(t *testing.T) {
+		primary := newTestServer(t, http.StatusNotFound, "")
+		defer primary.Close()
+		fallback := newTestServer(t, http.StatusServiceUnavailable, "")
+		defer fallback.Close()
+
+		policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+		td := NewTokenDirectory(Options{Sources: []Source{
+			NewHTTPSource(primary.URL, nil, HTTPSourceOptions{RetryPolicy: policy}),
+			NewHTTPSource(fallback.URL, nil, HTTPSourceOptions{RetryPolicy: policy}),
+		}})
+		_, err := td.FetchIndex(ctx)
+		if !errors.Is(err, ErrAllSourcesFailed) {
+			t.Fatalf("expected ErrAllSourcesFailed, got: %v", err)
+		}
+		failures := sourceErrors(err)
+		if len(failures) != 2 {
+			t.Fatalf("expected the error of each source, got: %v", err)
+		}
+		if failures[0].URL != primary.URL+"/index.json" || failures[0].StatusCode != http.StatusNotFound || failures[0].Attempt != 1 {
+			t.Fatalf("unexpected primary error: %+v", failures[0])
+		}
+		if failures[1].StatusCode != http.StatusServiceUnavailable || failures[1].Attempt != 3 {
+			t.Fatalf("unexpected fallback error: %+v", failures[1])
+		}
+		var sourceErr *SourceError
+		if !errors.As(err, &sourceErr) || sourceErr != failures[0] {
+			t.Fatalf("expected errors.As to find the first source error, got %+v", sourceErr)
+		}
+	})
+
+	t.Run("hash mismatch", func(t *testing.T) {
+		server := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/index.json" {
+				_, _ = w.Write([]byte(testIndexJSON))
+				return
+			}
+			_, _ = w.Write([]byte(`{"name":"Tampered","tokens":[]}`))
+		})
+		defer server.Close()
+
+		td := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(server.URL, nil)}})
+		tokenListURL := td.TokenListURL("mainnet", "erc20.json")
+		_, err := td.FetchTokenList(ctx, tokenListURL)
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || validationErr.URL != tokenListURL {
+			t.Fatalf("expected a validation error, got: %v", err)
+		}
+		var mismatchErr *HashMismatchError
+		if !errors.As(err, &mismatchErr) {
+			t.Fatalf("expected a hash mismatch, got: %v", err)
+		}
+		if mismatchErr.URL != tokenListURL || mismatchErr.Expected == mismatchErr.Got {
+			t.Fatalf("unexpected hash mismatch: %+v", mismatchErr)
+		}
+		var sourceErr *SourceError
+		if !errors.As(err, &sourceErr) || sourceErr.StatusCode != 0 {
+			t.Fatalf("unexpected source error: %+v", sourceErr)
+		}
+	})
+
+	t.Run("caller cancellation", func(t *testing.T) {
+		server := newTestServer(t, http.StatusOK, testIndexJSON)
+		defer server.Close()
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := NewTokenDirectory(Options{Sources: testSources(server, server)}).FetchIndex(canceled)
+		if !errors.Is(err, context.Canceled) || errors.Is(err, ErrAllSourcesFailed) {
+			t.Fatalf("expected the cancellation only, got: %v", err)
+		}
+	})
+}
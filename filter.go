@@ -0,0 +1,78 @@
+package tokendirectory
+
+import (
+	"slices"
+	"strings"
+)
+
+// ContractInfoFilter is a policy selecting which tokens are returned, set
+// once with Options.ContractInfoFilter and applied by
+// FetchTokenContractInfo, and therefore by the Registry, or passed to
+// Search. The zero value matches every token, and each field set narrows
+// the selection down.
+type ContractInfoFilter struct {
+	// ExcludeBlacklisted excludes the tokens with Extensions.Blacklist set.
+	ExcludeBlacklisted bool
+
+	// ExcludeMuted excludes the tokens with Extensions.Mute set.
+	ExcludeMuted bool
+
+	// OnlyVerified only matches the tokens with Extensions.Verified set.
+	OnlyVerified bool
+
+	// OnlyFeatured only matches the tokens with Extensions.Featured set.
+	OnlyFeatured bool
+
+	// Categories only matches the tokens in any of the given categories,
+	// compared case-insensitively.
+	Categories []string
+
+	// Types only matches the tokens of any of the given contract types,
+	// compared case-insensitively. Tokens without a type are ERC20 tokens.
+	Types []TokenStandard
+}
+
+// Match reports whether the token matches the filter.
+func (f ContractInfoFilter) Match(ci ContractInfo) bool {
+	ext := ci.Extensions
+	if f.ExcludeBlacklisted && ext.Blacklist {
+		return false
+	}
+	if f.ExcludeMuted && ext.Mute {
+		return false
+	}
+	if f.OnlyVerified && !ext.Verified {
+		return false
+	}
+	if f.OnlyFeatured && !ext.Featured {
+		return false
+	}
+	if len(f.Categories) > 0 && !slices.ContainsFunc(ext.Categories, func(category string) bool {
+		return containsFold(f.Categories, category)
+	}) {
+		return false
+	}
+	if len(f.Types) > 0 && !containsFold(f.Types, contractStandard(ci)) {
+		return false
+	}
+	return true
+}
+
+// Apply returns the tokens matching the filter, keeping their order.
+func (f ContractInfoFilter) Apply(contractInfo map[uint64][]ContractInfo) map[uint64][]ContractInfo {
+	out := make(map[uint64][]ContractInfo, len(contractInfo))
+	for chainID, contractInfos := range contractInfo {
+		filtered := []ContractInfo{}
+		for _, ci := range contractInfos {
+			if f.Match(ci) {
+				filtered = append(filtered, ci)
+			}
+		}
+		out[chainID] = filtered
+	}
+	return out
+}
+
+func containsFold[S ~string](values []S, s S) bool {
+	return slices.ContainsFunc(values, func(value S) bool { return strings.EqualFold(string(value), string(s)) })
+}
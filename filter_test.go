@@ -0,0 +1,81 @@
+package tokendirectory
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContractInfoFilter(t *testing.T) {
+	tokens := map[string]ContractInfo{
+		"plain":       {Type: "ERC20"},
+		"blacklisted": {Type: "ERC20", Extensions: ContractInfoExtension{Blacklist: true}},
+		"muted":       {Type: "ERC20", Extensions: ContractInfoExtension{Mute: true}},
+		"verified":    {Type: "ERC20", Extensions: ContractInfoExtension{Verified: true}},
+		"featured":    {Type: "ERC20", Extensions: ContractInfoExtension{Featured: true}},
+		"stablecoin":  {Type: "ERC20", Extensions: ContractInfoExtension{Categories: []string{"Stablecoin"}}},
+		"nft":         {Type: "ERC721"},
+		"untyped":     {},
+	}
+	tests := []struct {
+		name   string
+		filter ContractInfoFilter
+		reject []string
+	}{
+		{"zero value", ContractInfoFilter{}, nil},
+		{"exclude blacklisted", ContractInfoFilter{ExcludeBlacklisted: true}, []string{"blacklisted"}},
+		{"exclude muted", ContractInfoFilter{ExcludeMuted: true}, []string{"muted"}},
+		{"only verified", ContractInfoFilter{OnlyVerified: true}, []string{"plain", "blacklisted", "muted", "featured", "stablecoin", "nft", "untyped"}},
+		{"only featured", ContractInfoFilter{OnlyFeatured: true}, []string{"plain", "blacklisted", "muted", "verified", "stablecoin", "nft", "untyped"}},
+		{"categories", ContractInfoFilter{Categories: []string{"stablecoin"}}, []string{"plain", "blacklisted", "muted", "verified", "featured", "nft", "untyped"}},
+		{"types", ContractInfoFilter{Types: []TokenStandard{"erc721"}}, []string{"plain", "blacklisted", "muted", "verified", "featured", "stablecoin", "untyped"}},
+		{"untyped tokens are erc20", ContractInfoFilter{Types: []TokenStandard{TokenStandardERC20}}, []string{"nft"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, ci := range tokens {
+				rejected := false
+				for _, reject := range tt.reject {
+					rejected = rejected || reject == name
+				}
+				if got := tt.filter.Match(ci); got == rejected {
+					t.Fatalf("%s: expected match %v, got %v", name, !rejected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchTokenContractInfoFilter(t *testing.T) {
+	ctx := context.Background()
+	const token = "0x0000000000000000000000000000000000000001"
+
+	dir := newTestDirectory(map[string]string{
+		// the chain token list blacklists a token the external one does not
+		"1/erc20.json": testTokenList(1,
+			`{"chainId":1,"address":"`+token+`","symbol":"BAD","name":"Bad","extensions":{"blacklist":true}}`,
+			testToken(1, "0x0000000000000000000000000000000000000002", "GOOD", "Good"),
+		),
+		"_external/erc20.json": testTokenList(0, testToken(1, token, "BAD", "Bad")),
+	})
+	server := newHandlerTestServer(t, dir.handler)
+	defer server.Close()
+
+	td := NewTokenDirectory(Options{
+		Sources:            []Source{NewHTTPSource(server.URL, nil)},
+		ContractInfoFilter: &ContractInfoFilter{ExcludeBlacklisted: true},
+	})
+	contractInfo, err := td.FetchTokenContractInfo(ctx, mustFetchIndex(t, td))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(contractInfo[1]) != 1 || contractInfo[1][0].Symbol != "GOOD" {
+		t.Fatalf("expected the blacklisted token to be excluded, got %+v", contractInfo[1])
+	}
+
+	if filtered := (ContractInfoFilter{OnlyFeatured: true}).Apply(contractInfo); len(filtered[1]) != 0 || len(contractInfo[1]) != 1 {
+		t.Fatalf("expected Apply to return the matching tokens only, got %+v", filtered)
+	}
+	if results := Search(contractInfo, "good", SearchOptions{Filter: &ContractInfoFilter{OnlyVerified: true}}); len(results) != 0 {
+		t.Fatalf("expected the search to apply the filter, got %+v", results)
+	}
+}
@@ -3,3 +3,7 @@ module github.com/0xsequence/go-tokendirectory
 go 1.23.4
 
 toolchain go1.24.1
+
+require golang.org/x/crypto v0.41.0
+
+require golang.org/x/sys v0.35.0 // indirect
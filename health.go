@@ -0,0 +1,133 @@
+package tokendirectory
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// defaultSourceFailureThreshold opens the circuit breaker of a source on
+	// its first failure, so token lists move to the next source right away.
+	defaultSourceFailureThreshold = 1
+
+	// latencyWeight is the weight of the latest sample in the moving average
+	// of a source's latency.
+	latencyWeight = 0.3
+)
+
+// SourceHealth reports the health of one of the sources of a
+// TokenDirectory, as tracked from the fetches made to it.
+type SourceHealth struct {
+	// IndexURL identifies the source.
+	IndexURL string
+
+	// ConsecutiveFailures is the number of fetches which failed in a row.
+	ConsecutiveFailures int
+
+	// CircuitOpenUntil is set while the circuit breaker of the source is
+	// open, ie. while it is only used for token lists once all other
+	// sources have failed.
+	CircuitOpenUntil time.Time
+
+	// Latency is the moving average of the latency of successful fetches.
+	Latency time.Duration
+}
+
+// CircuitOpen reports whether the circuit breaker of the source is open.
+func (h SourceHealth) CircuitOpen() bool {
+	return time.Now().Before(h.CircuitOpenUntil)
+}
+
+// sourceHealth is the health tracked for each source, guarded by
+// TokenDirectory.mu.
+type sourceHealth struct {
+	failures  int
+	openUntil time.Time
+	latency   time.Duration
+}
+
+// SourceHealth returns the health of each source, in the configured order.
+func (d *TokenDirectory) SourceHealth() []SourceHealth {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]SourceHealth, len(d.sources))
+	for i, source := range d.sources {
+		out[i] = SourceHealth{
+			IndexURL:            source.IndexURL(),
+			ConsecutiveFailures: d.health[i].failures,
+			CircuitOpenUntil:    d.health[i].openUntil,
+			Latency:             d.health[i].latency,
+		}
+	}
+	return out
+}
+
+// sourcesByHealth returns the indexes of the sources ordered from the
+// healthiest to the least healthy: closed circuit breakers first, then
+// fewer consecutive failures, then sources which are not slow, and finally
+// the configured order.
+func (d *TokenDirectory) sourcesByHealth() []int {
+	now := time.Now()
+	d.mu.Lock()
+	health := make([]sourceHealth, len(d.health))
+	copy(health, d.health)
+	d.mu.Unlock()
+
+	// a source is considered slow when it uses up most of its budget
+	slow := sourceAttemptTimeout / 2
+
+	order := make([]int, len(health))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		hi, hj := health[order[i]], health[order[j]]
+		if openI, openJ := now.Before(hi.openUntil), now.Before(hj.openUntil); openI != openJ {
+			return openJ
+		}
+		if hi.failures != hj.failures {
+			return hi.failures < hj.failures
+		}
+		if slowI, slowJ := hi.latency > slow, hj.latency > slow; slowI != slowJ {
+			return slowJ
+		}
+		return false
+	})
+	return order
+}
+
+// recordSourceSuccess closes the circuit breaker of the source and updates
+// its latency.
+func (d *TokenDirectory) recordSourceSuccess(i int, latency time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h := &d.health[i]
+	h.failures = 0
+	h.openUntil = time.Time{}
+	if h.latency == 0 {
+		h.latency = latency
+	} else {
+		h.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(h.latency))
+	}
+}
+
+// recordSourceFailure counts a failure of the source, opening its circuit
+// breaker once the failure threshold is reached.
+func (d *TokenDirectory) recordSourceFailure(i int) {
+	threshold := d.options.SourceFailureThreshold
+	if threshold <= 0 {
+		threshold = defaultSourceFailureThreshold
+	}
+	cooldown := d.options.SourceCooldown
+	if cooldown <= 0 {
+		cooldown = d.indexTTL()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h := &d.health[i]
+	h.failures++
+	if h.failures >= threshold {
+		h.openUntil = time.Now().Add(cooldown)
+	}
+}
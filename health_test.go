@@ -0,0 +1,89 @@
+package tokendirectory
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSourceHealth(t *testing.T) {
+	ctx := context.Background()
+	tokenListHandler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.json" {
+			_, _ = w.Write([]byte(testIndexJSON))
+			return
+		}
+		_, _ = w.Write([]byte(testTokenListJSON))
+	}
+
+	t.Run("lists go to the healthiest mirror", func(t *testing.T) {
+		down := newTestServer(t, http.StatusServiceUnavailable, "")
+		defer down.Close()
+		mirror1 := newHandlerTestServer(t, tokenListHandler)
+		defer mirror1.Close()
+		mirror2 := newHandlerTestServer(t, tokenListHandler)
+		defer mirror2.Close()
+
+		td := NewTokenDirectory(Options{Sources: []Source{
+			NewHTTPSource(down.URL, nil),
+			NewHTTPSource(mirror1.URL, nil),
+			NewHTTPSource(mirror2.URL, nil),
+		}})
+		if _, err := td.FetchTokenList(ctx, td.TokenListURL("mainnet", "erc20.json")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.Equal(down.requestPaths(), []string{"/index.json"}) {
+			t.Fatalf("expected the failed source to be skipped for token lists, got %v", down.requestPaths())
+		}
+		if !slices.Equal(mirror1.requestPaths(), []string{"/index.json", "/mainnet/erc20.json"}) || mirror2.hitCount() != 0 {
+			t.Fatalf("expected the next mirror to serve everything, got %v and %v", mirror1.requestPaths(), mirror2.requestPaths())
+		}
+
+		health := td.SourceHealth()
+		if health[0].ConsecutiveFailures != 1 || !health[0].CircuitOpen() {
+			t.Fatalf("expected the failed source circuit to be open, got %+v", health[0])
+		}
+		if health[1].ConsecutiveFailures != 0 || health[1].Latency == 0 {
+			t.Fatalf("expected the mirror to be healthy with a latency, got %+v", health[1])
+		}
+	})
+
+	t.Run("failure threshold", func(t *testing.T) {
+		td := NewTokenDirectory(Options{
+			Sources:                []Source{NewHTTPSource("http://primary", nil), NewHTTPSource("http://fallback", nil)},
+			SourceFailureThreshold: 2,
+			SourceCooldown:         time.Hour,
+		})
+		td.recordSourceFailure(0)
+		if td.SourceHealth()[0].CircuitOpen() {
+			t.Fatal("expected the circuit to stay closed below the threshold")
+		}
+		if order := td.sourcesByHealth(); !slices.Equal(order, []int{1, 0}) {
+			t.Fatalf("expected the failing source to come last, got %v", order)
+		}
+		td.recordSourceFailure(0)
+		if !td.SourceHealth()[0].CircuitOpen() {
+			t.Fatal("expected the circuit to open at the threshold")
+		}
+		td.recordSourceSuccess(0, time.Millisecond)
+		if health := td.SourceHealth()[0]; health.CircuitOpen() || health.ConsecutiveFailures != 0 {
+			t.Fatalf("expected a success to close the circuit, got %+v", health)
+		}
+	})
+
+	t.Run("open circuits and slow sources come last", func(t *testing.T) {
+		td := NewTokenDirectory(Options{Sources: []Source{
+			NewHTTPSource("http://slow", nil),
+			NewHTTPSource("http://open", nil),
+			NewHTTPSource("http://fast", nil),
+		}})
+		td.recordSourceSuccess(0, sourceAttemptTimeout)
+		td.recordSourceFailure(1)
+		td.recordSourceSuccess(2, time.Millisecond)
+		if order := td.sourcesByHealth(); !slices.Equal(order, []int{2, 0, 1}) {
+			t.Fatalf("unexpected source order: %v", order)
+		}
+	})
+}
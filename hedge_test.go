@@ -0,0 +1,82 @@
+package tokendirectory
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHedgedRequests(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("slow primary is hedged", func(t *testing.T) {
+		canceled := make(chan struct{})
+		primary := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			close(canceled)
+		})
+		defer primary.Close()
+		fallback := newTestServer(t, http.StatusOK, testIndexJSON)
+		defer fallback.Close()
+
+		td := NewTokenDirectory(Options{Sources: testSources(primary, fallback), HedgeDelay: 20 * time.Millisecond})
+		start := time.Now()
+		if _, err := td.FetchIndex(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > sourceAttemptTimeout/2 {
+			t.Fatalf("expected the fallback to answer without waiting for the primary, took %v", elapsed)
+		}
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatal("expected the primary request to be canceled")
+		}
+		if health := td.SourceHealth()[0]; health.ConsecutiveFailures != 0 {
+			t.Fatalf("expected the canceled primary not to count as failed, got %+v", health)
+		}
+	})
+
+	t.Run("fast primary is not hedged", func(t *testing.T) {
+		primary := newTestServer(t, http.StatusOK, testIndexJSON)
+		defer primary.Close()
+		fallback := newTestServer(t, http.StatusOK, testIndexJSON)
+		defer fallback.Close()
+
+		td := NewTokenDirectory(Options{Sources: testSources(primary, fallback), HedgeDelay: time.Second})
+		if _, err := td.FetchIndex(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fallback.hitCount() != 0 {
+			t.Fatalf("expected no hedged request, got %d", fallback.hitCount())
+		}
+	})
+
+	t.Run("invalid responses do not win", func(t *testing.T) {
+		primary := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/index.json" {
+				_, _ = w.Write([]byte(testIndexJSON))
+				return
+			}
+			_, _ = w.Write([]byte(`{"name":"tampered","tokens":[]}`))
+		})
+		defer primary.Close()
+		fallback := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/index.json" {
+				time.Sleep(50 * time.Millisecond)
+			}
+			_, _ = w.Write([]byte(testTokenListJSON))
+		})
+		defer fallback.Close()
+
+		td := NewTokenDirectory(Options{Sources: testSources(primary, fallback), HedgeDelay: time.Millisecond})
+		list, err := td.FetchTokenList(ctx, td.TokenListURL("mainnet", "erc20.json"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if list.Name == "tampered" {
+			t.Fatal("expected the response failing validation to be rejected")
+		}
+	})
+}
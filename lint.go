@@ -0,0 +1,269 @@
+package tokendirectory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// lint issue codes
+const (
+	LintDuplicateAddress = "duplicate-address"
+	LintDuplicateSymbol  = "duplicate-symbol"
+	LintChainIDMismatch  = "chain-id-mismatch"
+	LintMissingDecimals  = "missing-decimals"
+	LintNativeAlias      = "native-alias"
+	LintBrokenBridge     = "broken-bridge-reference"
+)
+
+// LintIssue is an issue found in a token list.
+type LintIssue struct {
+	// Code identifies the kind of issue, eg. LintDuplicateAddress.
+	Code string `json:"code"`
+
+	TokenListURL string `json:"tokenListUrl,omitempty"`
+	ChainID      uint64 `json:"chainId,omitempty"`
+
+	// Token is the position of the token in the token list, or -1 if the
+	// issue is not about a single token.
+	Token   int    `json:"token"`
+	Address string `json:"address,omitempty"`
+
+	Message string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	var b strings.Builder
+	if i.TokenListURL != "" {
+		b.WriteString(i.TokenListURL)
+		b.WriteString(": ")
+	}
+	if i.Token >= 0 {
+		fmt.Fprintf(&b, "tokens[%d] ", i.Token)
+	}
+	if i.Address != "" {
+		fmt.Fprintf(&b, "%d:%s ", i.ChainID, i.Address)
+	}
+	fmt.Fprintf(&b, "%s [%s]", i.Message, i.Code)
+	return b.String()
+}
+
+// LintReport is the result of linting token lists. It marshals to JSON for
+// machines, and String formats it for humans.
+type LintReport struct {
+	Issues []LintIssue `json:"issues"`
+}
+
+// OK reports whether no issue was found.
+func (r LintReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r LintReport) String() string {
+	if r.OK() {
+		return "no issues found\n"
+	}
+	var b strings.Builder
+	for _, issue := range r.Issues {
+		b.WriteString(issue.String())
+		b.WriteByte('\n')
+	}
+	if len(r.Issues) == 1 {
+		b.WriteString("1 issue found\n")
+	} else {
+		fmt.Fprintf(&b, "%d issues found\n", len(r.Issues))
+	}
+	return b.String()
+}
+
+// LintTokenList lints a single token list, before publishing it: duplicate
+// addresses, the same symbol on different addresses of a chain, tokens
+// whose chain ID disagrees with the list, missing decimals, the native
+// 0xeee...e alias next to 0x000...0, and malformed bridge references.
+func LintTokenList(tokenList TokenList) LintReport {
+	var l linter
+	l.lintTokenList(tokenList)
+	l.lintSymbols([]TokenList{tokenList})
+	return l.report()
+}
+
+// LintTokenLists lints token lists together, eg. the whole index as
+// returned by FetchTokenLists. On top of the checks of LintTokenList, the
+// same symbol is looked for across the token lists of each chain, and
+// bridge references must point to tokens of the token lists.
+func LintTokenLists(tokenLists map[uint64][]TokenList) LintReport {
+	var l linter
+	var all []TokenList
+	for _, chainID := range slices.Sorted(maps.Keys(tokenLists)) {
+		for _, tokenList := range tokenLists[chainID] {
+			l.lintTokenList(tokenList)
+			all = append(all, tokenList)
+		}
+	}
+	l.lintSymbols(all)
+	l.lintMissingLinks(all)
+	return l.report()
+}
+
+// LintIndex fetches the token lists of the index and lints them together,
+// as LintTokenLists.
+func (d *TokenDirectory) LintIndex(ctx context.Context, index TokenDirectoryIndex) (LintReport, error) {
+	tokenLists, err := d.FetchTokenLists(ctx, index)
+	if err != nil {
+		return LintReport{}, err
+	}
+	return LintTokenLists(tokenLists), nil
+}
+
+type linter struct {
+	issues []LintIssue
+}
+
+func (l *linter) add(tokenList TokenList, token int, chainID uint64, address, code, format string, args ...any) {
+	l.issues = append(l.issues, LintIssue{
+		Code:         code,
+		TokenListURL: tokenList.TokenListURL,
+		ChainID:      chainID,
+		Token:        token,
+		Address:      address,
+		Message:      fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) lintTokenList(tokenList TokenList) {
+	seen := map[TokenKey]int{}
+	natives := map[uint64]bool{}
+	aliases := map[uint64]int{}
+
+	for i, token := range tokenList.Tokens {
+		key := tokenKey(token)
+		if first, ok := seen[key]; ok {
+			l.add(tokenList, i, token.ChainID, token.Address, LintDuplicateAddress, "duplicate of tokens[%d]", first)
+		} else {
+			seen[key] = i
+		}
+
+		if tokenList.ChainID != 0 && token.ChainID != tokenList.ChainID {
+			l.add(tokenList, i, token.ChainID, token.Address, LintChainIDMismatch, "chain ID %d differs from the list chain ID %d", token.ChainID, tokenList.ChainID)
+		}
+
+		if token.Decimals == nil && hasDecimals(token, tokenList) {
+			l.add(tokenList, i, token.ChainID, token.Address, LintMissingDecimals, "missing decimals")
+		}
+
+		switch key.Address {
+		case nativeAddress:
+			natives[token.ChainID] = true
+		case nativeAliasAddress:
+			aliases[token.ChainID] = i
+		}
+
+		for _, chain := range slices.Sorted(maps.Keys(token.Extensions.BridgeInfo)) {
+			bridge := token.Extensions.BridgeInfo[chain]
+			if chainID, err := strconv.ParseUint(chain, 10, 64); err != nil || chainID == 0 {
+				l.add(tokenList, i, token.ChainID, token.Address, LintBrokenBridge, "bridge reference to invalid chain ID %q", chain)
+			} else if !addressPattern.MatchString(bridge.TokenAddress) {
+				l.add(tokenList, i, token.ChainID, token.Address, LintBrokenBridge, "bridge reference on chain %s to invalid address %q", chain, bridge.TokenAddress)
+			}
+		}
+	}
+
+	for chainID, i := range aliases {
+		if natives[chainID] {
+			l.add(tokenList, i, chainID, nativeAliasAddress, LintNativeAlias, "native token alias next to %s", nativeAddress)
+		}
+	}
+}
+
+// lintSymbols reports the symbols used by different addresses on a chain.
+func (l *linter) lintSymbols(tokenLists []TokenList) {
+	type symbolKey struct {
+		chainID uint64
+		symbol  string
+	}
+	type occurrence struct {
+		tokenList TokenList
+		token     int
+	}
+	occurrences := map[symbolKey]map[string]occurrence{}
+	for _, tokenList := range tokenLists {
+		for i, token := range tokenList.Tokens {
+			symbol := strings.ToLower(strings.TrimSpace(token.Symbol))
+			if symbol == "" {
+				continue
+			}
+			address := normalizeAddress(token.Address)
+			if address == nativeAliasAddress {
+				// reported as a native alias instead
+				address = nativeAddress
+			}
+			key := symbolKey{token.ChainID, symbol}
+			if occurrences[key] == nil {
+				occurrences[key] = map[string]occurrence{}
+			}
+			if _, ok := occurrences[key][address]; !ok {
+				occurrences[key][address] = occurrence{tokenList, i}
+			}
+		}
+	}
+
+	for key, byAddress := range occurrences {
+		if len(byAddress) < 2 {
+			continue
+		}
+		addresses := slices.Sorted(maps.Keys(byAddress))
+		for _, address := range addresses {
+			o := byAddress[address]
+			token := o.tokenList.Tokens[o.token]
+			l.add(o.tokenList, o.token, key.chainID, token.Address, LintDuplicateSymbol, "symbol %s is used by %d addresses: %s", token.Symbol, len(addresses), strings.Join(addresses, ", "))
+		}
+	}
+}
+
+// lintMissingLinks reports the bridge and origin references to tokens
+// missing from the token lists.
+func (l *linter) lintMissingLinks(tokenLists []TokenList) {
+	type position struct {
+		tokenList TokenList
+		token     int
+	}
+	contractInfo := map[uint64][]ContractInfo{}
+	positions := map[TokenKey]position{}
+	for _, tokenList := range tokenLists {
+		for i, token := range tokenList.Tokens {
+			contractInfo[token.ChainID] = append(contractInfo[token.ChainID], token)
+			if _, ok := positions[tokenKey(token)]; !ok {
+				positions[tokenKey(token)] = position{tokenList, i}
+			}
+		}
+	}
+
+	for _, link := range BuildAssetGraph(contractInfo).MissingLinks() {
+		p := positions[link.From]
+		l.add(p.tokenList, p.token, link.From.ChainID, p.tokenList.Tokens[p.token].Address, LintBrokenBridge, "%s reference to missing token %d:%s", link.Kind, link.To.ChainID, link.To.Address)
+	}
+}
+
+func (l *linter) report() LintReport {
+	issues := l.issues
+	if issues == nil {
+		issues = []LintIssue{}
+	}
+	slices.SortStableFunc(issues, func(a, b LintIssue) int {
+		if c := cmp.Compare(a.TokenListURL, b.TokenListURL); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Token, b.Token); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Code, b.Code); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Message, b.Message)
+	})
+	return LintReport{Issues: issues}
+}
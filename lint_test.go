@@ -0,0 +1,88 @@
+package tokendirectory
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLintTokenList(t *testing.T) {
+	var tokenList TokenList
+	err := json.Unmarshal([]byte(`{"name":"Test","chainId":1,"tokens":[
+		{"chainId":1,"address":"0x0000000000000000000000000000000000000000","symbol":"ETH","decimals":18},
+		{"chainId":1,"address":"0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee","symbol":"ETH","decimals":18},
+		{"chainId":1,"address":"0x0000000000000000000000000000000000000001","symbol":"USDC","decimals":6},
+		{"chainId":1,"address":"0x0000000000000000000000000000000000000001","symbol":"USDC","decimals":6},
+		{"chainId":1,"address":"0x0000000000000000000000000000000000000002","symbol":"usdc","decimals":6},
+		{"chainId":137,"address":"0x0000000000000000000000000000000000000003","symbol":"WRONG","decimals":18},
+		{"chainId":1,"address":"0x0000000000000000000000000000000000000004","symbol":"NODEC"},
+		{"chainId":1,"address":"0x0000000000000000000000000000000000000005","symbol":"NFT","type":"ERC721"},
+		{"chainId":1,"address":"0x0000000000000000000000000000000000000006","symbol":"BRIDGED","decimals":18,
+		 "extensions":{"bridgeInfo":{"polygon":{"tokenAddress":"0x0000000000000000000000000000000000000007"},"10":{"tokenAddress":"0x07"}}}}
+	]}`), &tokenList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenList.TokenListURL = "list.json"
+
+	type issue struct {
+		token int
+		code  string
+	}
+	var got []issue
+	report := LintTokenList(tokenList)
+	for _, i := range report.Issues {
+		got = append(got, issue{i.Token, i.Code})
+	}
+	want := []issue{
+		{1, LintNativeAlias},
+		{2, LintDuplicateSymbol},
+		{3, LintDuplicateAddress},
+		{4, LintDuplicateSymbol},
+		{5, LintChainIDMismatch},
+		{6, LintMissingDecimals},
+		{8, LintBrokenBridge},
+		{8, LintBrokenBridge},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected issues %v, got %v", want, got)
+	}
+
+	text := report.String()
+	if !strings.Contains(text, "list.json: tokens[3] 1:0x0000000000000000000000000000000000000001 duplicate of tokens[2] [duplicate-address]") || !strings.HasSuffix(text, "8 issues found\n") {
+		t.Fatalf("unexpected text report:\n%s", text)
+	}
+	buf, err := json.Marshal(report)
+	if err != nil || !strings.Contains(string(buf), `"code":"native-alias"`) {
+		t.Fatalf("unexpected JSON report: %s %v", buf, err)
+	}
+
+	if report := LintTokenList(TokenList{Name: "Empty"}); !report.OK() || report.String() != "no issues found\n" {
+		t.Fatalf("expected no issues, got %v", report)
+	}
+}
+
+func TestLintTokenLists(t *testing.T) {
+	chainList := TokenList{TokenListURL: "mainnet", ChainID: 1, Tokens: []ContractInfo{
+		{ChainID: 1, Address: "0x01", Symbol: "USDC", Decimals: new(uint64)},
+	}}
+	externalList := TokenList{TokenListURL: "external", Tokens: []ContractInfo{
+		{ChainID: 1, Address: "0x02", Symbol: "USDC", Decimals: new(uint64)},
+		{ChainID: 137, Address: "0x03", Symbol: "USDC.e", Decimals: new(uint64), Extensions: ContractInfoExtension{OriginChainID: 1, OriginAddress: "0x09"}},
+	}}
+
+	report := LintTokenLists(map[uint64][]TokenList{1: {chainList}, 0: {externalList}})
+	var codes []string
+	for _, issue := range report.Issues {
+		codes = append(codes, issue.TokenListURL+" "+issue.Code)
+	}
+	want := []string{
+		"external " + LintDuplicateSymbol,
+		"external " + LintBrokenBridge,
+		"mainnet " + LintDuplicateSymbol,
+	}
+	if !slices.Equal(codes, want) {
+		t.Fatalf("expected issues %v, got %v", want, codes)
+	}
+}
@@ -0,0 +1,140 @@
+package tokendirectory
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// IndexUpdate is sent to subscribers by the background refresher whenever
+// the index changes.
+type IndexUpdate struct {
+	// Index is the full, newly fetched index.
+	Index TokenDirectoryIndex
+
+	// Diff holds the new or changed entries compared to the previous
+	// index, as returned by DiffIndex. On the first refresh it holds the
+	// full index.
+	Diff TokenDirectoryIndex
+
+	// Context is the context of the refresher, which is done when the
+	// refresher stops. Subscribers doing slow work, eg. fetching token
+	// lists, should use it so Stop does not wait for the work to finish.
+	Context context.Context
+}
+
+// Start runs a background refresher which re-fetches the index every
+// Options.RefreshInterval, prefetches the token lists which changed, and
+// notifies subscribers of the changes. The first refresh happens right
+// away. The refresher runs until ctx is done or Stop is called.
+func (d *TokenDirectory) Start(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.refreshDone != nil {
+		return fmt.Errorf("tokendirectory: refresher already started")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	d.refreshCancel = cancel
+	d.refreshDone = done
+
+	go func() {
+		defer close(done)
+		d.runRefresher(ctx)
+	}()
+	return nil
+}
+
+// Stop stops the background refresher started by Start and waits for it to
+// return. It is a no-op if the refresher is not running.
+func (d *TokenDirectory) Stop() {
+	d.mu.Lock()
+	cancel, done := d.refreshCancel, d.refreshDone
+	d.refreshCancel, d.refreshDone = nil, nil
+	d.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Subscribe registers fn to be called with every index update observed by
+// the background refresher, and returns a function to unsubscribe. The
+// callbacks are called one after another from the refresher goroutine, so
+// a slow callback delays the next refresh.
+func (d *TokenDirectory) Subscribe(fn func(IndexUpdate)) (unsubscribe func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.subscribers == nil {
+		d.subscribers = map[int]func(IndexUpdate){}
+	}
+	id := d.nextSubscriberID
+	d.nextSubscriberID++
+	d.subscribers[id] = fn
+
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		delete(d.subscribers, id)
+	}
+}
+
+func (d *TokenDirectory) runRefresher(ctx context.Context) {
+	interval := d.options.RefreshInterval
+	if interval <= 0 {
+		interval = d.indexTTL()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last TokenDirectoryIndex
+	for {
+		index, err := d.refreshIndex(ctx)
+		if err == nil {
+			if diff := DiffIndex(last, index); len(diff) > 0 {
+				d.prefetchTokenLists(ctx, diff)
+				d.notifySubscribers(IndexUpdate{Index: index, Diff: diff, Context: ctx})
+			}
+			last = index
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prefetchTokenLists fetches the token lists of the given index into the
+// cache. Failures are ignored, as the token lists will be fetched again on
+// demand.
+func (d *TokenDirectory) prefetchTokenLists(ctx context.Context, index TokenDirectoryIndex) {
+	if !d.UseCache() {
+		return
+	}
+	for _, entries := range index {
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return
+			}
+			_, _ = d.loadTokenList(ctx, entry.TokenListURL, entry.ContentHash)
+		}
+	}
+}
+
+func (d *TokenDirectory) notifySubscribers(update IndexUpdate) {
+	d.mu.Lock()
+	subscribers := make([]func(IndexUpdate), 0, len(d.subscribers))
+	for _, fn := range d.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	d.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(update)
+	}
+}
@@ -0,0 +1,106 @@
+package tokendirectory
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefresher(t *testing.T) {
+	ctx := context.Background()
+	updatedTokenListJSON := strings.Replace(testTokenListJSON, "Test List", "Updated List", 1)
+	updatedIndexJSON := strings.Replace(testIndexJSON, sha256Hash([]byte(testTokenListJSON)), sha256Hash([]byte(updatedTokenListJSON)), 1)
+
+	var mu sync.Mutex
+	indexJSON, tokenListJSON := testIndexJSON, testTokenListJSON
+	primary := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/index.json" {
+			_, _ = w.Write([]byte(indexJSON))
+			return
+		}
+		_, _ = w.Write([]byte(tokenListJSON))
+	})
+	defer primary.Close()
+	fallback := newTestServer(t, http.StatusInternalServerError, "")
+	defer fallback.Close()
+	sources := testSources(primary, fallback)
+
+	td := NewTokenDirectory(Options{Sources: sources, RefreshInterval: 10 * time.Millisecond})
+	updates := make(chan IndexUpdate, 10)
+	unsubscribe := td.Subscribe(func(update IndexUpdate) {
+		updates <- update
+	})
+	defer unsubscribe()
+
+	if err := td.Start(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer td.Stop()
+	if err := td.Start(ctx); err == nil {
+		t.Fatal("expected error when starting the refresher twice")
+	}
+
+	waitForUpdate := func() IndexUpdate {
+		t.Helper()
+		select {
+		case update := <-updates:
+			return update
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for index update")
+			return IndexUpdate{}
+		}
+	}
+
+	// the first update holds the full index, with its token lists prefetched
+	update := waitForUpdate()
+	if len(update.Diff[1]) != 1 || len(update.Index[1]) != 1 {
+		t.Fatalf("unexpected first update: %+v", update)
+	}
+	if !strings.Contains(strings.Join(primary.requestPaths(), ","), "/mainnet/erc20.json") {
+		t.Fatalf("expected the token list to be prefetched, paths: %v", primary.requestPaths())
+	}
+
+	mu.Lock()
+	indexJSON, tokenListJSON = updatedIndexJSON, updatedTokenListJSON
+	mu.Unlock()
+
+	update = waitForUpdate()
+	if len(update.Diff[1]) != 1 || update.Diff[1][0].ContentHash != sha256Hash([]byte(updatedTokenListJSON)) {
+		t.Fatalf("unexpected diff: %+v", update.Diff)
+	}
+
+	// the changed token list is served from the cache
+	listFetches := func() int {
+		n := 0
+		for _, path := range primary.requestPaths() {
+			if path == "/mainnet/erc20.json" {
+				n++
+			}
+		}
+		return n
+	}
+	fetches := listFetches()
+	tokenList, err := td.FetchTokenList(ctx, td.TokenListURL("mainnet", "erc20.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tokenList.Name != "Updated List" {
+		t.Fatalf("expected the updated token list, got %q", tokenList.Name)
+	}
+	if listFetches() != fetches {
+		t.Fatalf("expected the prefetched token list to be used, got %d new fetches", listFetches()-fetches)
+	}
+
+	td.Stop()
+	td.Stop()
+	select {
+	case update := <-updates:
+		t.Fatalf("did not expect updates without index changes, got %+v", update)
+	default:
+	}
+}
@@ -0,0 +1,146 @@
+package tokendirectory
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry is an in-memory index of the contract info of a TokenDirectory,
+// for constant time lookups by chain ID and address. Tokens are merged as
+// by FetchTokenContractInfo, ie. chain token lists take precedence over the
+// external token lists.
+//
+// The registry is empty until the first Refresh. It is rebuilt when Refresh
+// observes a change of the index, and on every index update of the
+// background refresher of the TokenDirectory. Lookups always see either
+// the previous or the rebuilt registry, never a mix of both.
+type Registry struct {
+	d           *TokenDirectory
+	state       atomic.Pointer[registryState]
+	unsubscribe func()
+
+	// mu serializes the rebuilds, so an older index never replaces a newer
+	// one
+	mu sync.Mutex
+}
+
+// TokenKey identifies a token by chain ID and address.
+type TokenKey struct {
+	ChainID uint64
+	Address string
+}
+
+type registryState struct {
+	index        TokenDirectoryIndex
+	contractInfo map[uint64][]ContractInfo
+	tokens       map[TokenKey]ContractInfo
+
+	// partial is set when some token lists of the index failed, so the
+	// next refresh retries them even if the index did not change
+	partial bool
+
+	assetsOnce sync.Once
+	assets     *AssetGraph
+}
+
+// NewRegistry returns a registry of the contract info of the directory.
+// Call Close to stop following the index updates of the directory.
+func NewRegistry(d *TokenDirectory) *Registry {
+	r := &Registry{d: d}
+	r.unsubscribe = d.Subscribe(func(update IndexUpdate) {
+		// the token lists were prefetched by the refresher, and on failure
+		// the registry keeps serving the previous index until the next
+		// update or Refresh. The rebuild is cancelled when the refresher
+		// stops.
+		_ = r.rebuild(update.Context, update.Index)
+	})
+	return r
+}
+
+// Close stops following the index updates of the directory. The registry
+// can still be used, and refreshed with Refresh.
+func (r *Registry) Close() {
+	r.unsubscribe()
+}
+
+// Refresh fetches the index of the directory, and rebuilds the registry if
+// the index changed since the last build. With Options.AllowPartialResults,
+// the registry is rebuilt from the token lists which could be fetched, and
+// the *PartialError is returned.
+func (r *Registry) Refresh(ctx context.Context) error {
+	index, err := r.d.fetchIndex(ctx)
+	if err != nil {
+		return err
+	}
+	return r.rebuild(ctx, index)
+}
+
+func (r *Registry) rebuild(ctx context.Context, index TokenDirectoryIndex) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if state := r.state.Load(); state != nil && !state.partial && !indexChanged(state.index, index) {
+		return nil
+	}
+
+	contractInfo, err := r.d.FetchTokenContractInfo(ctx, index)
+	var partialErr *PartialError
+	if err != nil && (ctx.Err() != nil || !errors.As(err, &partialErr)) {
+		// a cancelled rebuild is not a partial result
+		return err
+	}
+
+	state := &registryState{
+		index:        index,
+		contractInfo: contractInfo,
+		tokens:       map[TokenKey]ContractInfo{},
+		partial:      partialErr != nil,
+	}
+	for chainID, contractInfos := range contractInfo {
+		for _, ci := range contractInfos {
+			state.tokens[TokenKey{ChainID: chainID, Address: normalizeAddress(ci.Address)}] = ci
+		}
+	}
+	r.state.Store(state)
+	return err
+}
+
+// Lookup returns the contract info of the token at the given address on
+// the given chain. The address is case-insensitive.
+func (r *Registry) Lookup(chainID uint64, address string) (ContractInfo, bool) {
+	state := r.state.Load()
+	if state == nil {
+		return ContractInfo{}, false
+	}
+	ci, ok := state.tokens[TokenKey{ChainID: chainID, Address: normalizeAddress(address)}]
+	return ci, ok
+}
+
+// LookupMany returns the contract info of the given tokens, keyed as
+// given. Tokens which are not in the registry are left out.
+func (r *Registry) LookupMany(keys ...TokenKey) map[TokenKey]ContractInfo {
+	out := make(map[TokenKey]ContractInfo, len(keys))
+	state := r.state.Load()
+	if state == nil {
+		return out
+	}
+	for _, key := range keys {
+		if ci, ok := state.tokens[TokenKey{ChainID: key.ChainID, Address: normalizeAddress(key.Address)}]; ok {
+			out[key] = ci
+		}
+	}
+	return out
+}
+
+// indexChanged reports whether entries were added, removed or changed
+// between the two indexes.
+func indexChanged(index1, index2 TokenDirectoryIndex) bool {
+	return len(DiffIndex(index1, index2)) > 0 || len(DiffIndex(index2, index1)) > 0
+}
+
+func normalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
@@ -0,0 +1,195 @@
+package tokendirectory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testDirectory serves a token directory whose token lists can be replaced
+// while it is served. Groups are named after their chain ID, with
+// "_external" for the external token lists.
+type testDirectory struct {
+	mu    sync.Mutex
+	lists map[string]string // "group/file" -> token list JSON
+}
+
+func newTestDirectory(lists map[string]string) *testDirectory {
+	return &testDirectory{lists: lists}
+}
+
+func (td *testDirectory) set(path, tokenListJSON string) {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.lists[path] = tokenListJSON
+}
+
+func (td *testDirectory) handler(w http.ResponseWriter, r *http.Request) {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+
+	if r.URL.Path != "/index.json" {
+		buf, ok := td.lists[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(buf))
+		return
+	}
+
+	index := map[string]map[string]any{}
+	for path, buf := range td.lists {
+		group, file, _ := strings.Cut(path, "/")
+		if index[group] == nil {
+			var chainID uint64
+			if group != "_external" {
+				fmt.Sscan(group, &chainID)
+			}
+			index[group] = map[string]any{"chainId": chainID, "tokenLists": map[string]string{}}
+		}
+		index[group]["tokenLists"].(map[string]string)[file] = sha256Hash([]byte(buf))
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"index": index})
+}
+
+func testTokenList(chainID uint64, tokens ...string) string {
+	return fmt.Sprintf(`{"name":"Test","chainId":%d,"tokens":[%s]}`, chainID, strings.Join(tokens, ","))
+}
+
+func testToken(chainID uint64, address, symbol, name string) string {
+	return fmt.Sprintf(`{"chainId":%d,"address":%q,"symbol":%q,"name":%q,"decimals":18}`, chainID, address, symbol, name)
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	const usdc = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+
+	dir := newTestDirectory(map[string]string{
+		"1/erc20.json": testTokenList(1, testToken(1, usdc, "USDC", "USD Coin")),
+		"_external/erc20.json": testTokenList(0,
+			testToken(1, usdc, "USDC", "External USDC"),
+			testToken(137, "0x2791bca1f2de4661ed88a30c99a7a9449aa84174", "USDC.e", "Bridged USDC"),
+		),
+	})
+	server := newHandlerTestServer(t, dir.handler)
+	defer server.Close()
+
+	td := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(server.URL, nil)}, IndexTTL: time.Nanosecond})
+	r := NewRegistry(td)
+	defer r.Close()
+
+	if _, ok := r.Lookup(1, usdc); ok {
+		t.Fatal("expected an empty registry before the first refresh")
+	}
+	if err := r.Refresh(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ci, ok := r.Lookup(1, usdc)
+	if !ok || ci.Name != "USD Coin" {
+		t.Fatalf("expected the chain token list to take precedence, got %v %+v", ok, ci)
+	}
+	found := r.LookupMany(
+		TokenKey{ChainID: 1, Address: usdc},
+		TokenKey{ChainID: 137, Address: "0x2791BCA1F2DE4661ED88A30C99A7A9449AA84174"},
+		TokenKey{ChainID: 10, Address: usdc},
+	)
+	if len(found) != 2 || found[TokenKey{ChainID: 137, Address: "0x2791BCA1F2DE4661ED88A30C99A7A9449AA84174"}].Symbol != "USDC.e" {
+		t.Fatalf("unexpected lookups: %+v", found)
+	}
+
+	if results := r.Search("usd coin", SearchOptions{ChainIDs: []uint64{1}}); len(results) != 1 || results[0].Name != "USD Coin" {
+		t.Fatalf("unexpected search results: %+v", results)
+	}
+
+	if asset, ok := r.AssetGraph().Asset(1, usdc); !ok || len(asset.Tokens) != 1 {
+		t.Fatalf("unexpected asset: %+v", asset)
+	}
+
+	t.Run("unchanged index", func(t *testing.T) {
+		state := r.state.Load()
+		if err := r.Refresh(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if r.state.Load() != state {
+			t.Fatal("expected the registry not to be rebuilt")
+		}
+	})
+
+	t.Run("changed index", func(t *testing.T) {
+		dir.set("1/erc20.json", testTokenList(1, testToken(1, usdc, "USDC", "Renamed USD Coin")))
+		if err := r.Refresh(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ci, _ := r.Lookup(1, usdc); ci.Name != "Renamed USD Coin" {
+			t.Fatalf("expected the registry to be rebuilt, got %+v", ci)
+		}
+	})
+
+	t.Run("background refresher", func(t *testing.T) {
+		td := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(server.URL, nil)}, RefreshInterval: 10 * time.Millisecond, IndexTTL: time.Nanosecond})
+		r := NewRegistry(td)
+		defer r.Close()
+		if err := td.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer td.Stop()
+
+		dir.set("1/erc20.json", testTokenList(1, testToken(1, usdc, "USDC", "Refreshed USD Coin")))
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if ci, _ := r.Lookup(1, usdc); ci.Name == "Refreshed USD Coin" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("expected the registry to follow the refresher")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("stop cancels the rebuild", func(t *testing.T) {
+		listRequested := make(chan struct{}, 1)
+		stalled := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/index.json" {
+				select {
+				case listRequested <- struct{}{}:
+				default:
+				}
+				<-r.Context().Done()
+				return
+			}
+			dir.handler(w, r)
+		})
+		defer stalled.Close()
+
+		// without the cache, the token lists are fetched by the rebuild
+		// rather than prefetched by the refresher
+		td := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(stalled.URL, nil)}, NoCache: true, AllowPartialResults: true})
+		r := NewRegistry(td)
+		defer r.Close()
+		if err := td.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-listRequested:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected the registry to be rebuilt")
+		}
+
+		start := time.Now()
+		td.Stop()
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected Stop to cancel the rebuild, took %v", elapsed)
+		}
+		if _, ok := r.Lookup(1, usdc); ok {
+			t.Fatal("did not expect a cancelled rebuild to be stored")
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package tokendirectory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy configures how an HTTPSource retries a failed request before
+// the TokenDirectory moves on to the next source. Retries happen within the
+// budget of a single source attempt: a retry which would not fit in the
+// remaining time is not made.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	//
+	// Default is 0, meaning requests are not retried.
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the first retry, doubled on every
+	// further retry. A random jitter of up to half the backoff is
+	// subtracted from each wait.
+	//
+	// Default is 100ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the exponential backoff. It does not cap the wait
+	// requested by a Retry-After header, see MaxRetryAfter.
+	//
+	// Default is 2s.
+	MaxBackoff time.Duration
+
+	// MaxRetryAfter is the longest wait requested by a Retry-After header
+	// which is honored. A request asking for a longer wait is not retried,
+	// so the caller is not blocked for as long as the server asks, eg. when
+	// a single source is configured and no per-source budget applies.
+	//
+	// Default is 10s.
+	MaxRetryAfter time.Duration
+
+	// RetryableStatusCodes are the response status codes which are
+	// retried. Network errors are always retried.
+	//
+	// Default is 429, 500, 502, 503 and 504.
+	RetryableStatusCodes []int
+}
+
+var defaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// do calls fn until it succeeds, fails with an error which is not
+// retryable, or the attempts or the context's budget are exhausted.
+func (p *RetryPolicy) do(ctx context.Context, fn func() error) error {
+	maxAttempts := 1
+	if p != nil && p.MaxAttempts > 1 {
+		maxAttempts = p.MaxAttempts
+	}
+	var lastStatusErr *httpStatusError
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		// the retry decisions are made on this attempt's error alone
+		var statusErr *httpStatusError
+		hasStatus := errors.As(err, &statusErr)
+		if hasStatus {
+			lastStatusErr = statusErr
+		}
+		attemptErr := err
+		if attempt > 1 {
+			err = &attemptsError{attempts: attempt, err: err, lastStatusErr: lastStatusErr}
+		}
+		if attempt >= maxAttempts || ctx.Err() != nil || !p.retryable(attemptErr) {
+			return err
+		}
+
+		wait := p.backoff(attempt)
+		if hasStatus && statusErr.retryAfter > 0 {
+			if statusErr.retryAfter > p.maxRetryAfter() {
+				return err
+			}
+			wait = statusErr.retryAfter
+		}
+		// do not wait for a retry which cannot complete within the budget,
+		// so the next source still has time
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("waiting to retry: %w (last error: %w)", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) {
+		// network errors
+		return true
+	}
+	codes := p.RetryableStatusCodes
+	if codes == nil {
+		codes = defaultRetryableStatusCodes
+	}
+	return slices.Contains(codes, statusErr.statusCode)
+}
+
+func (p *RetryPolicy) maxRetryAfter() time.Duration {
+	if p.MaxRetryAfter > 0 {
+		return p.MaxRetryAfter
+	}
+	return 10 * time.Second
+}
+
+// backoff returns the wait before the given retry, with jitter.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 2 * time.Second
+	}
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, maxBackoff)
+	return backoff - rand.N(backoff/2+1)
+}
+
+// httpStatusError is returned for responses with an unexpected status code.
+type httpStatusError struct {
+	statusCode int
+	status     string
+	retryAfter time.Duration
+}
+
+func newHTTPStatusError(res *http.Response) *httpStatusError {
+	return &httpStatusError{
+		statusCode: res.StatusCode,
+		status:     res.Status,
+		retryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+	}
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("status %s", e.status)
+}
+
+// attemptsError records the number of attempts made before giving up on a
+// request which was retried, along with the last unexpected status seen,
+// eg. the 503 of an attempt before the last one timed out.
+type attemptsError struct {
+	attempts      int
+	err           error
+	lastStatusErr *httpStatusError
+}
+
+func (e *attemptsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *attemptsError) Unwrap() []error {
+	if e.lastStatusErr == nil || errors.Is(e.err, e.lastStatusErr) {
+		return []error{e.err}
+	}
+	return []error{e.err, e.lastStatusErr}
+}
+
+// parseRetryAfter parses a Retry-After header, given either in seconds or
+// as an HTTP date. It returns 0 if the header is missing or invalid.
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
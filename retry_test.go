@@ -0,0 +1,227 @@
+package tokendirectory
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPSourceRetry(t *testing.T) {
+	ctx := context.Background()
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	t.Run("retries retryable status", func(t *testing.T) {
+		var calls atomic.Int32
+		server := newHandlerTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(testIndexJSON))
+		})
+		defer server.Close()
+
+		source := NewHTTPSource(server.URL, nil, HTTPSourceOptions{RetryPolicy: policy})
+		buf, err := source.FetchIndex(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(buf) != testIndexJSON || server.hitCount() != 3 {
+			t.Fatalf("expected success on the third attempt, got %d hits", server.hitCount())
+		}
+	})
+
+	t.Run("does not retry other status", func(t *testing.T) {
+		server := newTestServer(t, http.StatusNotFound, "")
+		defer server.Close()
+
+		source := NewHTTPSource(server.URL, nil, HTTPSourceOptions{RetryPolicy: policy})
+		if _, err := source.FetchTokenList(ctx, "mainnet", "erc20.json"); err == nil {
+			t.Fatal("expected error")
+		}
+		if server.hitCount() != 1 {
+			t.Fatalf("expected a single attempt, got %d", server.hitCount())
+		}
+	})
+
+	t.Run("no policy", func(t *testing.T) {
+		server := newTestServer(t, http.StatusServiceUnavailable, "")
+		defer server.Close()
+
+		if _, err := NewHTTPSource(server.URL, nil).FetchIndex(ctx); err == nil {
+			t.Fatal("expected error")
+		}
+		if server.hitCount() != 1 {
+			t.Fatalf("expected a single attempt, got %d", server.hitCount())
+		}
+	})
+
+	t.Run("honors Retry-After", func(t *testing.T) {
+		var calls atomic.Int32
+		server := newHandlerTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+			if calls.Add(1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = w.Write([]byte(testIndexJSON))
+		})
+		defer server.Close()
+
+		source := NewHTTPSource(server.URL, nil, HTTPSourceOptions{RetryPolicy: policy})
+		start := time.Now()
+		if _, err := source.FetchIndex(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Fatalf("expected to wait for Retry-After, took %v", elapsed)
+		}
+	})
+
+	t.Run("does not wait beyond MaxRetryAfter", func(t *testing.T) {
+		server := newHandlerTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+		defer server.Close()
+
+		// a single source has no per-source budget
+		td := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(server.URL, nil, HTTPSourceOptions{RetryPolicy: policy})}})
+		start := time.Now()
+		if _, err := td.FetchIndex(ctx); err == nil || !strings.Contains(err.Error(), "429") {
+			t.Fatalf("expected the 429 to be reported, got: %v", err)
+		}
+		if server.hitCount() != 1 {
+			t.Fatalf("expected a single attempt, got %d", server.hitCount())
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected not to wait for Retry-After, took %v", elapsed)
+		}
+	})
+}
+
+func TestRetryWithinSourceBudget(t *testing.T) {
+	ctx := context.Background()
+	oldTimeout := sourceAttemptTimeout
+	sourceAttemptTimeout = 200 * time.Millisecond
+	defer func() { sourceAttemptTimeout = oldTimeout }()
+	policy := &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}
+
+	t.Run("Retry-After beyond the budget moves on", func(t *testing.T) {
+		primary := newHandlerTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+		defer primary.Close()
+		fallback := newTestServer(t, http.StatusOK, testIndexJSON)
+		defer fallback.Close()
+
+		td := NewTokenDirectory(Options{Sources: []Source{
+			NewHTTPSource(primary.URL, nil, HTTPSourceOptions{RetryPolicy: policy}),
+			NewHTTPSource(fallback.URL, nil, HTTPSourceOptions{RetryPolicy: policy}),
+		}})
+		start := time.Now()
+		if _, err := td.FetchIndex(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if primary.hitCount() != 1 {
+			t.Fatalf("expected no retry past the budget, got %d hits", primary.hitCount())
+		}
+		if elapsed := time.Since(start); elapsed > sourceAttemptTimeout {
+			t.Fatalf("expected to move on without waiting, took %v", elapsed)
+		}
+	})
+
+	t.Run("stalled retries report ErrSourceTimeout", func(t *testing.T) {
+		stall := func() *testServer {
+			return newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			})
+		}
+		primary, fallback := stall(), stall()
+		defer primary.Close()
+		defer fallback.Close()
+
+		sources := []Source{
+			NewHTTPSource(primary.URL, nil, HTTPSourceOptions{RetryPolicy: policy}),
+			NewHTTPSource(fallback.URL, nil, HTTPSourceOptions{RetryPolicy: policy}),
+		}
+		_, err := NewTokenDirectory(Options{Sources: sources}).FetchIndex(ctx)
+		if !errors.Is(err, ErrSourceTimeout) {
+			t.Fatalf("expected ErrSourceTimeout, got: %v", err)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("did not expect context.DeadlineExceeded to be visible, got: %v", err)
+		}
+	})
+
+	t.Run("timeouts after a retry report the attempts and status", func(t *testing.T) {
+		var calls atomic.Int32
+		primary := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			<-r.Context().Done()
+		})
+		defer primary.Close()
+		fallback := newTestServer(t, http.StatusNotFound, "")
+		defer fallback.Close()
+
+		sources := []Source{
+			NewHTTPSource(primary.URL, nil, HTTPSourceOptions{RetryPolicy: policy}),
+			NewHTTPSource(fallback.URL, nil, HTTPSourceOptions{RetryPolicy: policy}),
+		}
+		_, err := NewTokenDirectory(Options{Sources: sources}).FetchIndex(ctx)
+		if !errors.Is(err, ErrSourceTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected ErrSourceTimeout only, got: %v", err)
+		}
+		sourceErrs := sourceErrors(err)
+		if len(sourceErrs) != 2 {
+			t.Fatalf("expected the errors of both sources, got: %v", err)
+		}
+		if sourceErrs[0].Attempt != 2 || sourceErrs[0].StatusCode != http.StatusServiceUnavailable || !errors.Is(sourceErrs[0], ErrSourceTimeout) {
+			t.Fatalf("expected the timeout of the second attempt after a 503, got %+v", sourceErrs[0])
+		}
+		if sourceErrs[1].Attempt != 1 || sourceErrs[1].StatusCode != http.StatusNotFound {
+			t.Fatalf("expected a single 404 attempt, got %+v", sourceErrs[1])
+		}
+	})
+
+	t.Run("backoff beyond the remaining budget reports the last error", func(t *testing.T) {
+		primary := newTestServer(t, http.StatusServiceUnavailable, "")
+		defer primary.Close()
+		fallback := newTestServer(t, http.StatusServiceUnavailable, "")
+		defer fallback.Close()
+
+		// the first backoff fits in the budget, but the second one does not
+		slow := &RetryPolicy{MaxAttempts: 5, InitialBackoff: 150 * time.Millisecond, MaxBackoff: 150 * time.Millisecond}
+		sources := []Source{
+			NewHTTPSource(primary.URL, nil, HTTPSourceOptions{RetryPolicy: slow}),
+			NewHTTPSource(fallback.URL, nil, HTTPSourceOptions{RetryPolicy: slow}),
+		}
+		_, err := NewTokenDirectory(Options{Sources: sources}).FetchIndex(ctx)
+		if err == nil || !strings.Contains(err.Error(), "503") {
+			t.Fatalf("expected the last status to be reported, got: %v", err)
+		}
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("3"); got != 3*time.Second {
+		t.Fatalf("unexpected seconds: %v", got)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 58*time.Second || got > time.Minute {
+		t.Fatalf("unexpected date: %v", got)
+	}
+	for _, value := range []string{"", "soon", "-5"} {
+		if got := parseRetryAfter(value); got != 0 {
+			t.Fatalf("expected 0 for %q, got %v", value, got)
+		}
+	}
+}
@@ -1,29 +1,85 @@
 package tokendirectory
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// TokenStandard is the standard of a token contract, as set by
+// 0xsequence/token-directory on token lists and tokens.
+type TokenStandard string
+
+const (
+	TokenStandardERC20   TokenStandard = "ERC20"
+	TokenStandardERC721  TokenStandard = "ERC721"
+	TokenStandardERC1155 TokenStandard = "ERC1155"
+)
+
+// nativeAddress is the address of the native token of a chain in token
+// lists, and nativeAliasAddress is a common alias of it.
+const (
+	nativeAddress      = "0x0000000000000000000000000000000000000000"
+	nativeAliasAddress = "0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"
+)
+
+// tokenStandardOf returns the token standard of a token of the token list:
+// its type, or else the token standard of the list, or else ERC20 as the
+// Uniswap token list schema is for ERC20 tokens.
+func tokenStandardOf(token ContractInfo, tokenList TokenList) TokenStandard {
+	if token.Type == "" && tokenList.TokenStandard != "" {
+		return tokenList.TokenStandard
+	}
+	return contractStandard(token)
+}
+
+// contractStandard returns the token standard of a token outside of its
+// token list: its type, or else ERC20. The tokens of the fetched token
+// lists take the token standard of their list as type, see
+// normalizeTokenList.
+func contractStandard(token ContractInfo) TokenStandard {
+	if token.Type != "" {
+		return token.Type
+	}
+	return TokenStandardERC20
+}
+
+// tokenStandardFromFilename returns the token standard of a token list
+// file of a chain, which are named after it, eg. erc721.json.
+func tokenStandardFromFilename(file string) TokenStandard {
+	return TokenStandard(strings.ToUpper(strings.TrimSuffix(file, ".json")))
+}
 
 // TokenList structure based on https://raw.githubusercontent.com/Uniswap/token-lists/main/test/schema/example.tokenlist.json
 type TokenList struct {
 	Name          string         `json:"name"`
 	ChainID       uint64         `json:"chainId"`
-	TokenStandard string         `json:"tokenStandard"` // added by 0xsequence/token-directory
+	TokenStandard TokenStandard  `json:"tokenStandard"` // added by 0xsequence/token-directory
 	LogoURI       string         `json:"logoURI"`
 	Keywords      []string       `json:"keywords"`
 	Timestamp     *time.Time     `json:"timestamp"`
 	Tokens        []ContractInfo `json:"tokens"`
-	Version       interface{}    `json:"version"`
+	Version       *Version       `json:"version"`
 
 	// Fields for internal use as represented in the master index.json
 	TokenListURL string `json:"-"`
 	ContentHash  string `json:"-"`
 	Deprecated   bool   `json:"-"`
+
+	// Stale is set when the token list was served from a last-resort
+	// snapshot because all sources failed, and may be outdated.
+	Stale bool `json:"-"`
+
+	// SchemaViolations are the violations of the Uniswap token list schema
+	// found with Options.SchemaValidation set to SchemaValidationReport. It
+	// is non-nil, but empty, for valid token lists.
+	SchemaViolations []SchemaViolation `json:"-"`
 }
 
 type ContractInfo struct {
 	ChainID     uint64                `json:"chainId"`
 	Address     string                `json:"address"`
 	Name        string                `json:"name"`
-	Type        string                `json:"type,omitempty"` // added by 0xsequence/token-directory
+	Type        TokenStandard         `json:"type,omitempty"` // added by 0xsequence/token-directory
 	Symbol      string                `json:"symbol,omitempty"`
 	Decimals    *uint64               `json:"decimals"`
 	LogoURI     string                `json:"logoURI,omitempty"`
@@ -0,0 +1,229 @@
+package tokendirectory
+
+import (
+	"slices"
+	"strings"
+)
+
+// SearchOptions narrows down a token search.
+type SearchOptions struct {
+	// ChainIDs limits the search to the given chains.
+	//
+	// Default is all chains.
+	ChainIDs []uint64
+
+	// Types limits the search to the given contract types, compared
+	// case-insensitively. Tokens without a type are ERC20 tokens.
+	//
+	// Default is all types.
+	Types []TokenStandard
+
+	// Filter limits the search to the tokens matching the filter.
+	//
+	// Default is nil, meaning all tokens.
+	Filter *ContractInfoFilter
+
+	// Limit is the maximum number of results.
+	//
+	// Default is 0, meaning no limit.
+	Limit int
+}
+
+// match qualities, from the best to the worst
+const (
+	matchExactSymbol = iota
+	matchExactName
+	matchSymbolPrefix
+	matchNamePrefix
+	matchSubstring
+	matchTypo
+	matchSubsequence
+	noMatch
+)
+
+type searchResult struct {
+	ci    ContractInfo
+	match int
+}
+
+// Search returns the tokens whose symbol or name match the query, from the
+// contract info as returned by FetchTokenContractInfo. Matching is
+// case-insensitive, and from the best to the worst match: exact symbol,
+// exact name, symbol prefix, prefix of a word of the name, substring, a
+// single typo (two for longer queries), and finally the characters of the
+// query appearing in order. Tokens matching equally well are ranked
+// featured first, by FeatureIndex, then verified first.
+func Search(contractInfo map[uint64][]ContractInfo, query string, options ...SearchOptions) []ContractInfo {
+	var opts SearchOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+
+	var results []searchResult
+	for chainID, contractInfos := range contractInfo {
+		if len(opts.ChainIDs) > 0 && !slices.Contains(opts.ChainIDs, chainID) {
+			continue
+		}
+		for _, ci := range contractInfos {
+			if len(opts.Types) > 0 && !containsFold(opts.Types, contractStandard(ci)) {
+				continue
+			}
+			if opts.Filter != nil && !opts.Filter.Match(ci) {
+				continue
+			}
+			if match := matchToken(ci, query); match != noMatch {
+				results = append(results, searchResult{ci: ci, match: match})
+			}
+		}
+	}
+
+	slices.SortFunc(results, compareSearchResults)
+	if opts.Limit > 0 && len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+
+	out := make([]ContractInfo, len(results))
+	for i, result := range results {
+		out[i] = result.ci
+	}
+	return out
+}
+
+// Search returns the tokens of the registry whose symbol or name match the
+// query, as described by the Search function.
+func (r *Registry) Search(query string, options ...SearchOptions) []ContractInfo {
+	state := r.state.Load()
+	if state == nil {
+		return nil
+	}
+	return Search(state.contractInfo, query, options...)
+}
+
+func matchToken(ci ContractInfo, query string) int {
+	symbol := strings.ToLower(ci.Symbol)
+	name := strings.ToLower(ci.Name)
+	words := strings.Fields(name)
+
+	switch {
+	case symbol == query:
+		return matchExactSymbol
+	case name == query:
+		return matchExactName
+	case strings.HasPrefix(symbol, query):
+		return matchSymbolPrefix
+	case slices.ContainsFunc(words, func(word string) bool { return strings.HasPrefix(word, query) }) || strings.HasPrefix(name, query):
+		return matchNamePrefix
+	case strings.Contains(symbol, query) || strings.Contains(name, query):
+		return matchSubstring
+	}
+
+	// typos are only tolerated once the query is long enough to be
+	// meaningful
+	maxTypos := 0
+	if len(query) >= 8 {
+		maxTypos = 2
+	} else if len(query) >= 3 {
+		maxTypos = 1
+	}
+	if maxTypos > 0 {
+		typo := func(s string) bool { return s != "" && editDistance(s, query) <= maxTypos }
+		if typo(symbol) || typo(name) || slices.ContainsFunc(words, typo) {
+			return matchTypo
+		}
+	}
+
+	if isSubsequence(query, symbol) || isSubsequence(query, name) {
+		return matchSubsequence
+	}
+	return noMatch
+}
+
+func compareSearchResults(a, b searchResult) int {
+	if a.match != b.match {
+		return a.match - b.match
+	}
+	if a.ci.Extensions.Featured != b.ci.Extensions.Featured {
+		if a.ci.Extensions.Featured {
+			return -1
+		}
+		return 1
+	}
+	if fa, fb := featureRank(a.ci), featureRank(b.ci); fa != fb {
+		if fa < fb {
+			return -1
+		}
+		return 1
+	}
+	if a.ci.Extensions.Verified != b.ci.Extensions.Verified {
+		if a.ci.Extensions.Verified {
+			return -1
+		}
+		return 1
+	}
+	// then shorter symbols first, as closer to the query, and finally a
+	// stable order
+	if len(a.ci.Symbol) != len(b.ci.Symbol) {
+		return len(a.ci.Symbol) - len(b.ci.Symbol)
+	}
+	if c := strings.Compare(a.ci.Name, b.ci.Name); c != 0 {
+		return c
+	}
+	if a.ci.ChainID != b.ci.ChainID {
+		if a.ci.ChainID < b.ci.ChainID {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.ci.Address, b.ci.Address)
+}
+
+// featureRank returns the FeatureIndex of the token, ranking tokens
+// without one last.
+func featureRank(ci ContractInfo) int {
+	if ci.Extensions.FeatureIndex == 0 {
+		return 1000000
+	}
+	return ci.Extensions.FeatureIndex
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// isSubsequence reports whether the characters of query appear in s in
+// order.
+func isSubsequence(query, s string) bool {
+	rest := []rune(query)
+	for _, r := range s {
+		if len(rest) == 0 {
+			break
+		}
+		if r == rest[0] {
+			rest = rest[1:]
+		}
+	}
+	return len(rest) == 0
+}
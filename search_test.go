@@ -0,0 +1,71 @@
+package tokendirectory
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	contractInfo := map[uint64][]ContractInfo{
+		1: {
+			{ChainID: 1, Address: "0x01", Symbol: "USDC", Name: "USD Coin", Type: "ERC20", Extensions: ContractInfoExtension{Featured: true, FeatureIndex: 2, Verified: true}},
+			{ChainID: 1, Address: "0x02", Symbol: "USDT", Name: "Tether USD", Type: "ERC20", Extensions: ContractInfoExtension{Featured: true, FeatureIndex: 1, Verified: true}},
+			{ChainID: 1, Address: "0x03", Symbol: "USDC", Name: "Fake USD Coin", Type: "ERC20"},
+			{ChainID: 1, Address: "0x04", Symbol: "WETH", Name: "Wrapped Ether", Extensions: ContractInfoExtension{Verified: true}},
+			{ChainID: 1, Address: "0x05", Symbol: "PUNK", Name: "CryptoPunks", Type: "ERC721"},
+		},
+		137: {
+			{ChainID: 137, Address: "0x11", Symbol: "USDC", Name: "USD Coin", Type: "ERC20", Extensions: ContractInfoExtension{Verified: true}},
+		},
+	}
+	addresses := func(results []ContractInfo) []string {
+		out := make([]string, len(results))
+		for i, ci := range results {
+			out[i] = ci.Address
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		options SearchOptions
+		want    []string
+	}{
+		{"exact symbol ranked by featured then verified, then typos", "usdc", SearchOptions{}, []string{"0x01", "0x11", "0x03", "0x02"}},
+		{"symbol prefix ranked by feature index, then subsequences", "US", SearchOptions{}, []string{"0x02", "0x01", "0x11", "0x03", "0x05"}},
+		{"name word prefix before substring", "ether", SearchOptions{}, []string{"0x04", "0x02"}},
+		{"substring", "punks", SearchOptions{}, []string{"0x05"}},
+		{"typo", "wreth", SearchOptions{}, []string{"0x04"}},
+		{"subsequence", "wth", SearchOptions{}, []string{"0x04"}},
+		{"chain filter", "usdc", SearchOptions{ChainIDs: []uint64{137}}, []string{"0x11"}},
+		{"type filter", "p", SearchOptions{Types: []TokenStandard{"erc721"}}, []string{"0x05"}},
+		{"untyped tokens are erc20", "weth", SearchOptions{Types: []TokenStandard{TokenStandardERC20}}, []string{"0x04"}},
+		{"limit", "usdc", SearchOptions{Limit: 1}, []string{"0x01"}},
+		{"no match", "dai", SearchOptions{}, []string{}},
+		{"empty query", " ", SearchOptions{}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addresses(Search(contractInfo, tt.query, tt.options)); !slices.Equal(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"", "abc", 3},
+		{"weth", "weth", 0},
+		{"weth", "wreth", 1},
+		{"kitten", "sitting", 3},
+	} {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Fatalf("editDistance(%q, %q): expected %d, got %d", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
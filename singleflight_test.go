@@ -0,0 +1,136 @@
+package tokendirectory
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentFetchesAreCoalesced(t *testing.T) {
+	ctx := context.Background()
+	server := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		if r.URL.Path == "/index.json" {
+			_, _ = w.Write([]byte(testIndexJSON))
+			return
+		}
+		_, _ = w.Write([]byte(testTokenListJSON))
+	})
+	defer server.Close()
+
+	td := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(server.URL, nil)}})
+	tokenListURL := td.TokenListURL("mainnet", "erc20.json")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := td.FetchIndex(ctx)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := td.FetchTokenList(ctx, tokenListURL)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if hits := server.hitCount(); hits != 2 {
+		t.Fatalf("expected the index and the token list to be fetched once each, got %v", server.requestPaths())
+	}
+}
+
+func TestFlightGroup(t *testing.T) {
+	t.Run("shared error", func(t *testing.T) {
+		var g flightGroup[int]
+		release := make(chan struct{})
+		calls := 0
+		fn := func(context.Context) (int, error) {
+			calls++
+			<-release
+			return 0, errors.New("boom")
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, 3)
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = g.do(context.Background(), "key", fn)
+			}()
+		}
+		// let every caller join the call before it completes
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		if calls != 1 {
+			t.Fatalf("expected a single call, got %d", calls)
+		}
+		for _, err := range errs {
+			if err == nil || err.Error() != "boom" {
+				t.Fatalf("expected the shared error, got: %v", err)
+			}
+		}
+	})
+
+	t.Run("a caller giving up does not cancel the others", func(t *testing.T) {
+		var g flightGroup[int]
+		fn := func(ctx context.Context) (int, error) {
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(50 * time.Millisecond):
+				return 42, nil
+			}
+		}
+
+		impatient, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		done := make(chan int)
+		go func() {
+			v, _ := g.do(context.Background(), "key", fn)
+			done <- v
+		}()
+		if _, err := g.do(impatient, "key", fn); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the impatient caller to time out, got: %v", err)
+		}
+		if v := <-done; v != 42 {
+			t.Fatalf("expected the shared result, got %d", v)
+		}
+	})
+
+	t.Run("canceled once every caller gave up", func(t *testing.T) {
+		var g flightGroup[int]
+		canceled := make(chan struct{})
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+		_, err := g.do(ctx, "key", func(ctx context.Context) (int, error) {
+			<-ctx.Done()
+			close(canceled)
+			return 0, ctx.Err()
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got: %v", err)
+		}
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatal("expected the call to be canceled")
+		}
+	})
+}
@@ -0,0 +1,57 @@
+// Package snapshot embeds a snapshot of the token directory index and token
+// lists, to be used as a last-resort source when the remote sources are
+// unavailable:
+//
+//	td := tokendirectory.NewTokenDirectory(tokendirectory.Options{
+//		Snapshot: snapshot.Source(),
+//	})
+//
+// The snapshot committed to this repository is EMPTY: it only holds an
+// index without token lists, and Source serves nothing until the snapshot
+// is generated with `go generate ./snapshot`, which requires network access
+// to the token directory. Generate it in a checkout or vendored copy of the
+// module before building, and check Empty at startup to make sure the
+// binary embeds one. An empty snapshot is treated as unavailable, so
+// fetches fail as they would without a snapshot.
+//
+// Alternatively, write a snapshot into a package of your own with
+// cmd/tokendirectory-snapshot, embed it, and serve it with
+// tokendirectory.NewFSSource.
+package snapshot
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+
+	"github.com/0xsequence/go-tokendirectory"
+)
+
+//go:generate go run ../cmd/tokendirectory-snapshot -out .
+
+//go:embed all:index
+var files embed.FS
+
+// FS returns the embedded snapshot, laid out like the token-directory
+// repository, ie. with index/index.json and index/<group>/<file>.
+func FS() fs.FS {
+	return files
+}
+
+// Source returns a tokendirectory.Source serving the embedded snapshot.
+func Source() tokendirectory.Source {
+	return tokendirectory.NewFSSource(files)
+}
+
+// Empty reports whether the embedded snapshot holds no token lists, ie. it
+// was not generated, in which case Source serves nothing.
+func Empty() bool {
+	buf, err := fs.ReadFile(files, "index/index.json")
+	if err != nil {
+		return true
+	}
+	var index struct {
+		Index map[string]json.RawMessage `json:"index"`
+	}
+	return json.Unmarshal(buf, &index) != nil || len(index.Index) == 0
+}
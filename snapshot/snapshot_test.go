@@ -0,0 +1,49 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"path"
+	"testing"
+)
+
+func TestSnapshotFiles(t *testing.T) {
+	buf, err := fs.ReadFile(FS(), "index/index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index struct {
+		Index map[string]struct {
+			TokenLists map[string]string `json:"tokenLists"`
+		} `json:"index"`
+	}
+	if err := json.Unmarshal(buf, &index); err != nil {
+		t.Fatal(err)
+	}
+	if empty := len(index.Index) == 0; Empty() != empty {
+		t.Fatalf("expected Empty to report %v", empty)
+	}
+	if Empty() {
+		t.Skip("the snapshot is empty, generate it with go generate ./snapshot")
+	}
+	if _, ok := index.Index["_external"]; !ok {
+		t.Fatal("expected the snapshot to include the _external token lists")
+	}
+
+	// every token list of the index is embedded, including the ones of
+	// the _external group which go:embed leaves out without all:
+	for group, entry := range index.Index {
+		for file, hash := range entry.TokenLists {
+			buf, err := fs.ReadFile(FS(), path.Join("index", group, file))
+			if err != nil {
+				t.Fatalf("expected %s/%s to be embedded: %v", group, file, err)
+			}
+			sum := sha256.Sum256(buf)
+			if got := hex.EncodeToString(sum[:]); got != hash {
+				t.Fatalf("content hash mismatch for %s/%s: expected %s, got %s", group, file, hash, got)
+			}
+		}
+	}
+}
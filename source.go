@@ -0,0 +1,221 @@
+package tokendirectory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultSourceURL is the primary source for the token directory index
+	// and token lists, served from the GitHub repository.
+	DefaultSourceURL = "https://raw.githubusercontent.com/0xsequence/token-directory/master/index"
+
+	// DefaultFallbackSourceURL is the fallback source for the token
+	// directory index and token lists, served from a public GCS bucket
+	// mirror. It is used when the primary source is unavailable (e.g. rate
+	// limited or returning errors).
+	DefaultFallbackSourceURL = "https://storage.googleapis.com/token-directory-index/index"
+)
+
+// Source serves the token directory index and token lists, laid out like
+// the index directory of the token-directory repository.
+//
+// A TokenDirectory fetches from its sources in order, falling back to the
+// next source when one fails. The URLs of the first source identify token
+// lists, see TokenDirectoryIndexEntry.TokenListURL.
+type Source interface {
+	// IndexURL returns the location of index.json in this source.
+	IndexURL() string
+
+	// TokenListURL returns the location of the token list file within the
+	// given index group (eg. "mainnet" or "_external") in this source.
+	TokenListURL(group string, file string) string
+
+	// FetchIndex returns the raw contents of index.json.
+	FetchIndex(ctx context.Context) ([]byte, error)
+
+	// FetchTokenList returns the raw contents of the token list file within
+	// the given index group.
+	FetchTokenList(ctx context.Context, group string, file string) ([]byte, error)
+}
+
+// DefaultSources returns the default sources, the GitHub repository
+// followed by its GCS mirror, fetched with the given client. A nil client
+// means http.DefaultClient.
+func DefaultSources(client *http.Client, options ...HTTPSourceOptions) []Source {
+	return []Source{
+		NewHTTPSource(DefaultSourceURL, client, options...),
+		NewHTTPSource(DefaultFallbackSourceURL, client, options...),
+	}
+}
+
+type HTTPSourceOptions struct {
+	// RetryPolicy configures how failed requests to the source are retried.
+	//
+	// Default is nil, meaning requests are not retried.
+	RetryPolicy *RetryPolicy
+}
+
+// HTTPSource is a Source served over HTTP from a base URL, eg. the GitHub
+// repository, the GCS mirror or a self-hosted mirror.
+//
+// Index fetches are conditional: the ETag and Last-Modified validators of
+// the last index response are sent along, so an unchanged index is
+// answered with 304 Not Modified and not downloaded again.
+type HTTPSource struct {
+	baseURL     string
+	client      *http.Client
+	retryPolicy *RetryPolicy
+
+	indexResponse conditionalResponse
+	mu            sync.Mutex
+}
+
+var _ Source = &HTTPSource{}
+
+// NewHTTPSource creates a Source serving the index and token lists from
+// baseURL, ie. baseURL/index.json and baseURL/<group>/<file>. A nil client
+// means http.DefaultClient.
+func NewHTTPSource(baseURL string, client *http.Client, options ...HTTPSourceOptions) *HTTPSource {
+	opts := HTTPSourceOptions{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPSource{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		client:      client,
+		retryPolicy: opts.RetryPolicy,
+	}
+}
+
+func (s *HTTPSource) IndexURL() string {
+	return fmt.Sprintf("%s/index.json", s.baseURL)
+}
+
+func (s *HTTPSource) TokenListURL(group string, file string) string {
+	return fmt.Sprintf("%s/%s/%s", s.baseURL, group, file)
+}
+
+func (s *HTTPSource) FetchIndex(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	cached := s.indexResponse
+	s.mu.Unlock()
+
+	var buf []byte
+	var res conditionalResponse
+	err := s.retryPolicy.do(ctx, func() error {
+		var err error
+		buf, res, err = fetchURLConditional(ctx, s.client, s.IndexURL(), cached)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.indexResponse = res
+	s.mu.Unlock()
+	return buf, nil
+}
+
+func (s *HTTPSource) FetchTokenList(ctx context.Context, group string, file string) ([]byte, error) {
+	var buf []byte
+	err := s.retryPolicy.do(ctx, func() error {
+		var err error
+		buf, err = fetchURL(ctx, s.client, s.TokenListURL(group, file))
+		return err
+	})
+	return buf, err
+}
+
+func (s *HTTPSource) parseTokenListURL(url string) (string, string, bool) {
+	return parseTokenListURL(s.baseURL, url)
+}
+
+// tokenListURLParser is implemented by sources which can locate a token
+// list from its URL.
+type tokenListURLParser interface {
+	// parseTokenListURL returns the index group and file of a token list
+	// URL served by the source.
+	parseTokenListURL(url string) (string, string, bool)
+}
+
+// parseTokenListURL returns the index group and file of a token list URL
+// of the form baseURL/<group>/<file>.
+func parseTokenListURL(baseURL string, url string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(url, baseURL+"/")
+	if !ok {
+		return "", "", false
+	}
+	group, file, ok := strings.Cut(rest, "/")
+	if !ok || group == "" || file == "" || strings.Contains(file, "/") {
+		return "", "", false
+	}
+	return group, file, true
+}
+
+// fetchURL fetches a single URL and returns its body if it responds with
+// 200 OK. The body is fully read before returning, so the caller may cancel
+// the context afterwards.
+func fetchURL(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	buf, _, err := fetchURLConditional(ctx, client, url, conditionalResponse{})
+	return buf, err
+}
+
+// conditionalResponse is the last successful response from a URL fetched
+// with conditional requests.
+type conditionalResponse struct {
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// fetchURLConditional is like fetchURL, but sends the validators of the
+// cached response along, and returns the cached body on a 304 Not Modified
+// response. It returns the response to remember for the next request.
+func fetchURLConditional(ctx context.Context, client *http.Client, url string, cached conditionalResponse) ([]byte, conditionalResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, cached, fmt.Errorf("creating request: %w", err)
+	}
+	if cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	if cached.lastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.lastModified)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, cached, fmt.Errorf("request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified && cached.body != nil {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return cached.body, cached, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		// drain the body so the connection can be reused
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil, cached, newHTTPStatusError(res)
+	}
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, cached, fmt.Errorf("reading body: %w", err)
+	}
+
+	etag := res.Header.Get("ETag")
+	lastModified := res.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return buf, conditionalResponse{}, nil
+	}
+	return buf, conditionalResponse{etag: etag, lastModified: lastModified, body: buf}, nil
+}
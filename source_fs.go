@@ -0,0 +1,78 @@
+package tokendirectory
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// FSSource is a Source served from a file system laid out like the
+// token-directory repository, ie. with index/index.json and
+// index/<group>/<file>. It allows using the token directory offline, on its
+// own or as the last fallback after the remote sources.
+//
+// Token lists read from an FSSource are validated against the content
+// hashes of the index just like remote ones.
+type FSSource struct {
+	fsys    fs.FS
+	baseURL string
+}
+
+var _ Source = &FSSource{}
+
+// NewFSSource creates a Source reading the token directory from fsys, eg. an
+// embed.FS. Its URLs are of the form fs://index/<group>/<file>.
+func NewFSSource(fsys fs.FS) *FSSource {
+	return &FSSource{fsys: fsys, baseURL: "fs://index"}
+}
+
+// NewDirSource creates a Source reading the token directory from dir, eg. a
+// checkout of the token-directory repository. Its URLs are file:// URLs
+// within dir.
+func NewDirSource(dir string) *FSSource {
+	baseURL := filepath.ToSlash(dir)
+	if abs, err := filepath.Abs(dir); err == nil {
+		baseURL = filepath.ToSlash(abs)
+	}
+	return &FSSource{fsys: os.DirFS(dir), baseURL: "file://" + path.Join(baseURL, "index")}
+}
+
+func (s *FSSource) IndexURL() string {
+	return fmt.Sprintf("%s/index.json", s.baseURL)
+}
+
+func (s *FSSource) TokenListURL(group string, file string) string {
+	return fmt.Sprintf("%s/%s/%s", s.baseURL, group, file)
+}
+
+func (s *FSSource) FetchIndex(ctx context.Context) ([]byte, error) {
+	return s.readFile(ctx, "index/index.json")
+}
+
+func (s *FSSource) FetchTokenList(ctx context.Context, group string, file string) ([]byte, error) {
+	name := path.Join("index", group, file)
+	// the group and file come from the index, make sure they do not point
+	// outside of the index directory
+	if path.Dir(path.Dir(name)) != "index" {
+		return nil, fmt.Errorf("invalid token list path %q", name)
+	}
+	return s.readFile(ctx, name)
+}
+
+func (s *FSSource) readFile(ctx context.Context, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	buf, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	return buf, nil
+}
+
+func (s *FSSource) parseTokenListURL(url string) (string, string, bool) {
+	return parseTokenListURL(s.baseURL, url)
+}
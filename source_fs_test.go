@@ -0,0 +1,102 @@
+package tokendirectory
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS(tokenListJSON string) fstest.MapFS {
+	return fstest.MapFS{
+		"index/index.json":         {Data: []byte(testIndexJSON)},
+		"index/mainnet/erc20.json": {Data: []byte(tokenListJSON)},
+	}
+}
+
+func TestFSSource(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("on its own", func(t *testing.T) {
+		td := NewTokenDirectory(Options{Sources: []Source{NewFSSource(testFS(testTokenListJSON))}})
+		index, err := td.FetchIndex(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if url := index[1][0].TokenListURL; url != "fs://index/mainnet/erc20.json" {
+			t.Fatalf("unexpected token list URL: %s", url)
+		}
+		tokenList, err := td.FetchTokenList(ctx, index[1][0].TokenListURL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(tokenList.Tokens) != 1 {
+			t.Fatalf("expected 1 token, got %d", len(tokenList.Tokens))
+		}
+	})
+
+	t.Run("content hash mismatch", func(t *testing.T) {
+		fsys := testFS(strings.Replace(testTokenListJSON, "Test List", "Tampered List", 1))
+		td := NewTokenDirectory(Options{Sources: []Source{NewFSSource(fsys)}})
+		if _, err := td.FetchTokenList(ctx, td.TokenListURL("mainnet", "erc20.json")); err == nil || !strings.Contains(err.Error(), "content hash mismatch") {
+			t.Fatalf("expected content hash mismatch, got: %v", err)
+		}
+	})
+
+	t.Run("last fallback", func(t *testing.T) {
+		primary := newTestServer(t, http.StatusServiceUnavailable, "")
+		defer primary.Close()
+		fallback := newTestServer(t, http.StatusTooManyRequests, "")
+		defer fallback.Close()
+
+		sources := append(testSources(primary, fallback), NewFSSource(testFS(testTokenListJSON)))
+		td := NewTokenDirectory(Options{Sources: sources})
+		url := td.TokenListURL("mainnet", "erc20.json")
+		if !strings.HasPrefix(url, primary.URL) {
+			t.Fatalf("expected token lists to be identified by the primary source, got %s", url)
+		}
+		tokenList, err := td.FetchTokenList(ctx, url)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tokenList.Name != "Test List" {
+			t.Fatalf("unexpected token list: %q", tokenList.Name)
+		}
+	})
+
+	t.Run("path outside of index", func(t *testing.T) {
+		source := NewFSSource(testFS(testTokenListJSON))
+		if _, err := source.FetchTokenList(ctx, "..", "index/index.json"); err == nil {
+			t.Fatal("expected error for a path outside of the index")
+		}
+	})
+}
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	for name, file := range testFS(testTokenListJSON) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, file.Data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := NewDirSource(dir)
+	if url := source.TokenListURL("mainnet", "erc20.json"); url != "file://"+filepath.ToSlash(dir)+"/index/mainnet/erc20.json" {
+		t.Fatalf("unexpected token list URL: %s", url)
+	}
+	td := NewTokenDirectory(Options{Sources: []Source{source}})
+	tokenLists, err := td.FetchChainTokenLists(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokenLists) != 1 || len(tokenLists[0].Tokens) != 1 {
+		t.Fatalf("unexpected token lists: %+v", tokenLists)
+	}
+}
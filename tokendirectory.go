@@ -7,7 +7,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"slices"
 	"sort"
@@ -29,19 +28,91 @@ func NewTokenDirectory(options ...Options) *TokenDirectory {
 	if opts.HTTPClient != nil {
 		client = opts.HTTPClient
 	}
-	return &TokenDirectory{
-		options:        opts,
-		client:         client,
-		tokenListCache: map[string]TokenList{},
+	cache := opts.Cache
+	if cache == nil {
+		cache = NewMemoryCache()
 	}
+	sources := opts.Sources
+	if len(sources) == 0 {
+		sources = DefaultSources(client, HTTPSourceOptions{RetryPolicy: opts.RetryPolicy})
+	}
+	d := &TokenDirectory{
+		options: opts,
+		client:  client,
+		sources: sources,
+		health:  make([]sourceHealth, len(sources)),
+		cache:   cache,
+	}
+	if opts.CacheDir != "" && !opts.NoCache {
+		d.diskCache = newDiskCache(opts.CacheDir)
+	}
+	return d
 }
 
 type Options struct {
-	// HTTPClient is the HTTP client to use for fetching the token directory.
+	// HTTPClient is the HTTP client to use for fetching the token directory
+	// from the default sources and for token lists outside of it.
 	//
 	// Default is http.DefaultClient.
 	HTTPClient *http.Client
 
+	// Sources is the list of sources to fetch the index and token lists
+	// from, in order of preference, eg. a self-hosted mirror or a local
+	// directory. The first source identifies the token lists, see
+	// TokenDirectoryIndexEntry.TokenListURL.
+	//
+	// Default is nil, which means DefaultSources is used.
+	Sources []Source
+
+	// SourceFailureThreshold is the number of consecutive failures after
+	// which the circuit breaker of a source opens. While open, token lists
+	// are only fetched from the source once all other sources have failed.
+	// Index refreshes still probe every source in order, so a recovered
+	// source closes its circuit breaker again.
+	//
+	// Default is 1, meaning a source is avoided after its first failure.
+	SourceFailureThreshold int
+
+	// SourceCooldown is how long the circuit breaker of a source stays open.
+	//
+	// Default is 0, which means IndexTTL is used.
+	SourceCooldown time.Duration
+
+	// RetryPolicy configures how failed requests to the default sources are
+	// retried before moving on to the next source. Custom Sources configure
+	// their own, see HTTPSourceOptions.
+	//
+	// Default is nil, meaning requests are not retried.
+	RetryPolicy *RetryPolicy
+
+	// HedgeDelay enables hedged requests: when a source has not responded
+	// within HedgeDelay, the next source is requested too, and the first
+	// valid response wins while the other requests are canceled.
+	//
+	// Default is 0, meaning sources are only requested one after another.
+	HedgeDelay time.Duration
+
+	// MaxConcurrency is the maximum number of token lists fetched at once by
+	// FetchTokenLists, FetchChainTokenLists and FetchExternalTokenLists.
+	//
+	// Default is 8.
+	MaxConcurrency int
+
+	// CollectAllErrors makes the token list fetches carry on when a token
+	// list fails, and report the errors of all the failed token lists.
+	//
+	// Default is false, meaning the remaining fetches are canceled on the
+	// first failure, and only that failure is reported.
+	CollectAllErrors bool
+
+	// AllowPartialResults makes the token list fetches return every token
+	// list which could be fetched along with a *PartialError reporting the
+	// ones which failed, rather than failing altogether. It implies
+	// CollectAllErrors.
+	//
+	// Default is false.
+	AllowPartialResults bool
+
 	// ChainIDs is a list of chain IDs to fetch, acting as a filter on top of the index.
 	// If not provided, all chain IDs will be fetched.
 	//
@@ -73,6 +144,21 @@ type Options struct {
 	// Default is false, meaning all token standards will be included.
 	OnlyERC20 bool
 
+	// TokenStandards is a list of token standards to fetch, eg. to fetch
+	// the NFT collection lists only. The token lists of chains are filtered
+	// by their index filename, eg. erc721.json, and the tokens of the
+	// external token lists by their type, or else by the token standard of
+	// their list, or else as ERC20 tokens. It applies on top of OnlyERC20.
+	//
+	// Default is all token standards.
+	TokenStandards []TokenStandard
+
+	// ContractInfoFilter is the policy selecting the tokens returned by
+	// FetchTokenContractInfo, eg. to exclude the blacklisted tokens.
+	//
+	// Default is nil, meaning all tokens are returned.
+	ContractInfoFilter *ContractInfoFilter
+
 	// NoCache is a flag to disable the local token list cache.
 	// The cache works by checking the content hash of the Index
 	// with the content hash of the TokenList. If the content hash
@@ -80,42 +166,115 @@ type Options struct {
 	//
 	// Default is false, therefore the cache is enabled.
 	NoCache bool
+
+	// Cache is the cache used to store token lists between fetches,
+	// eg. an LRU from NewLRUCache or a store shared between processes.
+	// It is ignored when NoCache is set.
+	//
+	// Default is nil, which means an unbounded in-memory cache is used.
+	Cache Cache
+
+	// CacheDir is a directory used to persist the index and token lists
+	// across process restarts. Token lists are stored by URL and content
+	// hash, and are only reused while their hash still matches the index.
+	// The directory may be shared by several processes. It is ignored
+	// when NoCache is set.
+	//
+	// Default is "", meaning nothing is persisted to disk.
+	CacheDir string
+
+	// IndexTTL is how long the fetched index is memoized before it is
+	// refreshed from the remote source.
+	//
+	// Default is 30 seconds.
+	IndexTTL time.Duration
+
+	// IndexMaxStale enables stale-while-revalidate for the index. Once the
+	// index is older than IndexTTL, it is still returned right away for up
+	// to IndexMaxStale longer while it is refreshed in the background.
+	// Past that, callers wait for the refresh as usual.
+	//
+	// Default is 0, meaning callers always wait for an expired index to be
+	// refreshed.
+	IndexMaxStale time.Duration
+
+	// RefreshInterval is how often the background refresher started with
+	// TokenDirectory.Start re-fetches the index.
+	//
+	// Default is 0, which means IndexTTL is used.
+	RefreshInterval time.Duration
+
+	// SchemaValidation validates the token lists against the Uniswap token
+	// list schema, either reporting the violations on the token lists, or
+	// rejecting the token lists with violations.
+	//
+	// Default is SchemaValidationOff.
+	SchemaValidation SchemaValidation
+
+	// VerifyChecksums adds the EIP-55 checksum mismatches of the mixed-case
+	// addresses of the token lists to the schema violations. It has no
+	// effect with SchemaValidationOff. The cached token lists which were not
+	// validated, eg. by a Cache serializing them, are fetched again as their
+	// addresses were lowercased.
+	//
+	// Default is false.
+	VerifyChecksums bool
+
+	// RejectVersionDowngrades rejects a token list whose version is lower
+	// than the version of the token list last fetched from the same URL,
+	// moving on to the next source. Token lists without a version, or with
+	// a version in a form which is not supported, are not checked.
+	//
+	// Default is false.
+	RejectVersionDowngrades bool
+
+	// Snapshot is a last-resort source, used only when all Sources fail,
+	// eg. the snapshot embedded by the snapshot package, which is empty
+	// until it is generated, see snapshot.Empty. The index entries
+	// and token lists served from it are marked as Stale, and are neither
+	// cached nor persisted.
+	//
+	// Default is nil, meaning fetches fail when all Sources fail.
+	Snapshot Source
 }
 
-// Note: these are vars (not consts) only so that tests can point them at
-// httptest servers. Tests that mutate them must not run in parallel.
-var (
-	// tokenDirectoryBaseSourceURL is the primary source for the token directory
-	// index and token lists, served from the GitHub repository.
-	tokenDirectoryBaseSourceURL = "https://raw.githubusercontent.com/0xsequence/token-directory/master/index"
+// defaultIndexTTL is how long a fetched index is memoized by default
+// before it is fetched again from the remote source.
+const defaultIndexTTL = 30 * time.Second
 
-	// tokenDirectoryFallbackSourceURL is the fallback source for the token
-	// directory index and token lists, served from a public GCS bucket mirror.
-	// It is used when the primary source is unavailable (e.g. rate limited or
-	// returning errors).
-	tokenDirectoryFallbackSourceURL = "https://storage.googleapis.com/token-directory-index/index"
-)
+const defaultMaxConcurrency = 8
 
 // sourceAttemptTimeout bounds how long a single source (primary or fallback)
 // can take before we move on to the next, so a stalled primary still leaves
 // room for the mirror. It is a var only so tests can shorten it.
 var sourceAttemptTimeout = 10 * time.Second
 
-// ErrSourceTimeout is reported (wrapped) when a single source exceeds
-// sourceAttemptTimeout while the caller's context is still alive. It lets
-// callers distinguish "the source was slow" (safe to retry) from the
-// caller's own context deadline expiring.
-var ErrSourceTimeout = errors.New("source timed out")
-
 type TokenDirectory struct {
 	options Options
 	client  *http.Client
 
-	index          TokenDirectoryIndex
-	indexFetchedAt time.Time
-	preferFallback bool
+	index           TokenDirectoryIndex
+	indexFile       tokenDirectoryIndexFile
+	indexFetchedAt  time.Time
+	indexRefreshing bool
 
-	tokenListCache map[string]TokenList
+	indexFlight     flightGroup[TokenDirectoryIndex]
+	tokenListFlight flightGroup[TokenList]
+
+	sources []Source
+	health  []sourceHealth
+
+	// tokenListVersions are the versions of the token lists last fetched,
+	// by token list URL.
+	tokenListVersions map[string]Version
+
+	cache     Cache
+	diskCache *diskCache
+
+	refreshCancel    context.CancelFunc
+	refreshDone      chan struct{}
+	subscribers      map[int]func(IndexUpdate)
+	nextSubscriberID int
 
 	mu sync.Mutex
 }
@@ -166,43 +325,159 @@ func (d *TokenDirectory) fetchIndex(ctx context.Context, optFilter ...IndexFilte
 		filter = &optFilter[0]
 	}
 
-	// we memoize the index for 30 seconds to refrain from fetching from
-	// the remote source too often.
+	// we memoize the index for 30 seconds (or the configured IndexTTL) to
+	// refrain from fetching from the remote source too often.
+	indexTTL := d.indexTTL()
 	d.mu.Lock()
-	indexFetchedAt := d.indexFetchedAt
-	if time.Since(indexFetchedAt) < 30*time.Second {
+	indexAge := time.Since(d.indexFetchedAt)
+	if indexAge < indexTTL {
+		tdIndex := filteredIndex(d.index, filter)
+		d.mu.Unlock()
+		return tdIndex, nil
+	}
+	if d.index != nil && indexAge < indexTTL+d.options.IndexMaxStale {
+		// serve the stale index and refresh it in the background, detached
+		// from the caller so it is not canceled when the caller returns. The
+		// refresh gets its own deadline, as a hung source would otherwise
+		// keep it, and every later refresh joining it, stuck forever.
 		tdIndex := filteredIndex(d.index, filter)
+		if !d.indexRefreshing {
+			d.indexRefreshing = true
+			go func() {
+				refreshCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sourceAttemptTimeout*time.Duration(max(len(d.sources), 1)))
+				defer cancel()
+				_, _ = d.refreshIndex(refreshCtx)
+				d.mu.Lock()
+				d.indexRefreshing = false
+				d.mu.Unlock()
+			}()
+		}
 		d.mu.Unlock()
 		return tdIndex, nil
 	}
 	d.mu.Unlock()
 
-	// Fetch the index from the primary (GitHub) source, falling back to the
-	// GCS mirror if the primary is unavailable.
+	tdIndex, err := d.refreshIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filteredIndex(tdIndex, filter), nil
+}
+
+// refreshIndex fetches and memoizes the index, sharing a refresh already in
+// flight rather than fetching it again.
+func (d *TokenDirectory) refreshIndex(ctx context.Context) (TokenDirectoryIndex, error) {
+	return d.indexFlight.do(ctx, "index", d.loadIndex)
+}
+
+// loadIndex fetches the index, from the cache dir if it was persisted
+// recently enough or else from the remote source, and memoizes it.
+func (d *TokenDirectory) loadIndex(ctx context.Context) (TokenDirectoryIndex, error) {
+	// A recently persisted index, possibly written by another process
+	// sharing the cache dir, is as good as a fresh fetch.
+	if d.diskCache != nil {
+		if buf, fetchedAt, ok := d.diskCache.readIndex(d.indexTTL()); ok {
+			if indexFile, err := decodeIndex(buf); err == nil {
+				tdIndex := d.buildIndex(indexFile)
+				d.memoizeIndex(indexFile, tdIndex, fetchedAt)
+				return tdIndex, nil
+			}
+		}
+	}
+
+	// Fetch the index from the primary source (by default GitHub), falling
+	// back to the next sources (by default the GCS mirror) if the primary
+	// is unavailable.
 	var indexFile tokenDirectoryIndexFile
 	validateIndex := func(buf []byte) error {
-		var candidate tokenDirectoryIndexFile
-		if err := json.Unmarshal(buf, &candidate); err != nil {
-			return fmt.Errorf("unmarshalling index.json: %w", err)
-		}
-		if candidate.Index == nil {
-			return fmt.Errorf("index.json is missing index")
+		candidate, err := decodeIndex(buf)
+		if err != nil {
+			return err
 		}
 		indexFile = candidate
 		return nil
 	}
 
-	_, err := d.fetchManagedURLs(
-		ctx,
-		TokenDirectoryIndexURL(),
-		TokenDirectoryFallbackIndexURL(),
-		true,
-		validateIndex,
-	)
+	buf, err := d.fetchManaged(ctx, true, "", "", validateIndex)
 	if err != nil {
-		return nil, fmt.Errorf("tokendirectory: fetching index.json: %w", err)
+		if d.options.Snapshot == nil {
+			return nil, fmt.Errorf("tokendirectory: fetching index.json: %w", err)
+		}
+		tdIndex, snapshotErr := d.fetchSnapshotIndex(ctx)
+		if snapshotErr != nil {
+			return nil, fmt.Errorf("tokendirectory: fetching index.json: %w", errors.Join(err, snapshotErr))
+		}
+		return tdIndex, nil
+	}
+
+	if d.diskCache != nil {
+		// persisting is best effort, the index is still usable in memory
+		_ = d.diskCache.writeIndex(buf)
+	}
+
+	tdIndex := d.buildIndex(indexFile)
+	d.memoizeIndex(indexFile, tdIndex, time.Now())
+	return tdIndex, nil
+}
+
+// fetchSnapshotIndex fetches the index from the last-resort snapshot
+// source and memoizes it, with all of its entries marked as stale.
+func (d *TokenDirectory) fetchSnapshotIndex(ctx context.Context) (TokenDirectoryIndex, error) {
+	buf, err := d.options.Snapshot.FetchIndex(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching snapshot %s: %w", d.options.Snapshot.IndexURL(), err)
+	}
+	indexFile, err := decodeIndex(buf)
+	if err != nil {
+		return nil, fmt.Errorf("fetching snapshot %s: %w", d.options.Snapshot.IndexURL(), err)
+	}
+	if len(indexFile.Index) == 0 {
+		// an empty snapshot, eg. one which was never generated, is no
+		// better than failing
+		return nil, fmt.Errorf("fetching snapshot %s: index.json is empty", d.options.Snapshot.IndexURL())
 	}
 
+	tdIndex := d.buildIndex(indexFile)
+	for _, entries := range tdIndex {
+		for i := range entries {
+			entries[i].Stale = true
+		}
+	}
+	d.memoizeIndex(indexFile, tdIndex, time.Now())
+	return tdIndex, nil
+}
+
+// memoizeIndex memoizes the index, along with the index file it was built
+// from for the chain catalog.
+func (d *TokenDirectory) memoizeIndex(indexFile tokenDirectoryIndexFile, tdIndex TokenDirectoryIndex, fetchedAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.index = tdIndex
+	d.indexFile = indexFile
+	d.indexFetchedAt = fetchedAt
+}
+
+func (d *TokenDirectory) indexTTL() time.Duration {
+	if d.options.IndexTTL > 0 {
+		return d.options.IndexTTL
+	}
+	return defaultIndexTTL
+}
+
+func decodeIndex(buf []byte) (tokenDirectoryIndexFile, error) {
+	var indexFile tokenDirectoryIndexFile
+	if err := json.Unmarshal(buf, &indexFile); err != nil {
+		return tokenDirectoryIndexFile{}, fmt.Errorf("unmarshalling index.json: %w", err)
+	}
+	if indexFile.Index == nil {
+		return tokenDirectoryIndexFile{}, fmt.Errorf("index.json is missing index")
+	}
+	return indexFile, nil
+}
+
+// buildIndex converts the index file into a TokenDirectoryIndex, applying
+// the chain, deprecation and token list filters from the options.
+func (d *TokenDirectory) buildIndex(indexFile tokenDirectoryIndexFile) TokenDirectoryIndex {
 	tdIndex := TokenDirectoryIndex{}
 
 	for name, group := range indexFile.Index {
@@ -233,8 +508,11 @@ func (d *TokenDirectory) fetchIndex(ctx context.Context, optFilter ...IndexFilte
 			if name != "_external" && d.options.OnlyERC20 && file != "erc20.json" {
 				continue
 			}
+			if name != "_external" && len(d.options.TokenStandards) > 0 && !containsFold(d.options.TokenStandards, tokenStandardFromFilename(file)) {
+				continue
+			}
 
-			tokenListURL := TokenDirectoryTokenListURL(name, file)
+			tokenListURL := d.TokenListURL(name, file)
 			if len(d.options.TokenListURLs) > 0 && !slices.Contains(d.options.TokenListURLs, tokenListURL) {
 				continue
 			}
@@ -244,6 +522,7 @@ func (d *TokenDirectory) fetchIndex(ctx context.Context, optFilter ...IndexFilte
 			}
 
 			tdIndex[chainID] = append(tdIndex[chainID], TokenDirectoryIndexEntry{
+				Group:        name,
 				ChainID:      chainID,
 				Deprecated:   deprecated,
 				Filename:     file,
@@ -257,22 +536,26 @@ func (d *TokenDirectory) fetchIndex(ctx context.Context, optFilter ...IndexFilte
 		})
 	}
 
-	d.mu.Lock()
-	d.index = tdIndex
-	d.indexFetchedAt = time.Now()
-	d.mu.Unlock()
-
-	return filteredIndex(tdIndex, filter), nil
+	return tdIndex
 }
 
 type TokenDirectoryIndex map[uint64][]TokenDirectoryIndexEntry
 
 type TokenDirectoryIndexEntry struct {
-	ChainID      uint64
+	ChainID uint64
+
+	// Group is the name of the index group of the token list, eg. "mainnet",
+	// "polygon" or "_external".
+	Group string
+
 	Deprecated   bool
 	Filename     string
 	ContentHash  string
 	TokenListURL string
+
+	// Stale is set when the entry was served from Options.Snapshot because
+	// all sources failed, and may be outdated.
+	Stale bool
 }
 
 func (d *TokenDirectory) FetchChainTokenLists(ctx context.Context, chainID uint64) ([]TokenList, error) {
@@ -280,24 +563,7 @@ func (d *TokenDirectory) FetchChainTokenLists(ctx context.Context, chainID uint6
 	if err != nil {
 		return nil, err
 	}
-
-	tokenLists := []TokenList{}
-
-	for indexChainID, indexEntries := range index {
-		if indexChainID != chainID {
-			continue
-		}
-
-		for _, entry := range indexEntries {
-			tokenList, err := d.fetchTokenList(ctx, entry.TokenListURL, entry.ContentHash)
-			if err != nil {
-				return nil, err
-			}
-			tokenLists = append(tokenLists, tokenList)
-		}
-	}
-
-	return tokenLists, nil
+	return d.fetchTokenLists(ctx, index[chainID])
 	// index, err := d.fetchIndex(ctx, IndexFilter{ChainIDs: []uint64{chainID}})
 	// if err != nil {
 	// 	return nil, err
@@ -318,24 +584,7 @@ func (d *TokenDirectory) FetchExternalTokenLists(ctx context.Context) ([]TokenLi
 	if err != nil {
 		return nil, err
 	}
-
-	tokenLists := []TokenList{}
-
-	for indexChainID, indexEntries := range index {
-		if indexChainID != 0 {
-			continue
-		}
-
-		for _, entry := range indexEntries {
-			tokenList, err := d.fetchTokenList(ctx, entry.TokenListURL, entry.ContentHash)
-			if err != nil {
-				return nil, err
-			}
-			tokenLists = append(tokenLists, tokenList)
-		}
-	}
-
-	return tokenLists, nil
+	return d.fetchTokenLists(ctx, index[0])
 	// index, err := d.fetchIndex(ctx, IndexFilter{External: true})
 	// if err != nil {
 	// 	return nil, err
@@ -352,27 +601,160 @@ func (d *TokenDirectory) FetchExternalTokenLists(ctx context.Context) ([]TokenLi
 }
 
 func (d *TokenDirectory) FetchTokenLists(ctx context.Context, index TokenDirectoryIndex) (map[uint64][]TokenList, error) {
+	// fetch the token lists of all chains at once, in a deterministic order
+	chainIDs := make([]uint64, 0, len(index))
+	for chainID := range index {
+		chainIDs = append(chainIDs, chainID)
+	}
+	slices.Sort(chainIDs)
+	var entries []TokenDirectoryIndexEntry
+	var entryChainIDs []uint64
+	for _, chainID := range chainIDs {
+		for _, entry := range index[chainID] {
+			entries = append(entries, entry)
+			entryChainIDs = append(entryChainIDs, chainID)
+		}
+	}
+
+	fetched, errs, err := d.fetchEntries(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+
 	tokenLists := map[uint64][]TokenList{}
-	for chainID, entries := range index {
+	for _, chainID := range chainIDs {
 		tokenLists[chainID] = []TokenList{}
-		for _, entry := range entries {
+	}
+	for i, chainID := range entryChainIDs {
+		if errs[i] == nil {
+			tokenLists[chainID] = append(tokenLists[chainID], fetched[i])
+		}
+	}
+	return tokenLists, newPartialError(entries, errs)
+}
+
+// fetchTokenLists fetches the token lists of the given entries, returning
+// them in the order of the entries.
+func (d *TokenDirectory) fetchTokenLists(ctx context.Context, entries []TokenDirectoryIndexEntry) ([]TokenList, error) {
+	fetched, errs, err := d.fetchEntries(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+	tokenLists := make([]TokenList, 0, len(fetched))
+	for i, tokenList := range fetched {
+		if errs[i] == nil {
+			tokenLists = append(tokenLists, tokenList)
+		}
+	}
+	return tokenLists, newPartialError(entries, errs)
+}
+
+// fetchEntries fetches the token lists of the given entries concurrently,
+// with at most Options.MaxConcurrency fetches at once, and returns them
+// along with their errors in the order of the entries. The errors of the
+// entries are only returned with Options.AllowPartialResults, as otherwise
+// any failure fails the whole fetch.
+func (d *TokenDirectory) fetchEntries(ctx context.Context, entries []TokenDirectoryIndexEntry) ([]TokenList, []error, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	maxConcurrency := d.options.MaxConcurrency
+	if maxConcurrency <= 0 {
+		maxConcurrency = defaultMaxConcurrency
+	}
+	collectAll := d.options.CollectAllErrors || d.options.AllowPartialResults
+
+	var (
+		wg         sync.WaitGroup
+		sem        = make(chan struct{}, maxConcurrency)
+		failOnce   sync.Once
+		firstErr   error
+		errs       = make([]error, len(entries))
+		tokenLists = make([]TokenList, len(entries))
+	)
+	for i, entry := range entries {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
 			tokenList, err := d.fetchTokenList(ctx, entry.TokenListURL, entry.ContentHash)
 			if err != nil {
-				return nil, err
+				errs[i] = err
+				if !collectAll {
+					failOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+				return
 			}
-			tokenLists[chainID] = append(tokenLists[chainID], tokenList)
+			tokenLists[i] = tokenList
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	// the caller gave up before all the fetches were done
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if !d.options.AllowPartialResults {
+		if err := errors.Join(errs...); err != nil {
+			return nil, nil, err
 		}
 	}
+	return tokenLists, errs, nil
+}
 
-	return tokenLists, nil
+// newPartialError reports the entries which failed, if any.
+func newPartialError(entries []TokenDirectoryIndexEntry, errs []error) error {
+	var failures []TokenListFailure
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, newTokenListFailure(entries[i], err))
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return &PartialError{Failures: failures}
 }
 
 func (d *TokenDirectory) FetchTokenContractInfo(ctx context.Context, index TokenDirectoryIndex) (map[uint64][]ContractInfo, error) {
 	tokenListMap, err := d.FetchTokenLists(ctx, index)
-	if err != nil {
+	var partialErr *PartialError
+	if err != nil && !errors.As(err, &partialErr) {
 		return nil, err
 	}
 
+	// with partial results, a broken token list is reported rather than
+	// failing everything
+	skip := func(tokenList TokenList, chainID uint64, err error) bool {
+		if !d.options.AllowPartialResults {
+			return false
+		}
+		if partialErr == nil {
+			partialErr = &PartialError{}
+		}
+		partialErr.Failures = append(partialErr.Failures, TokenListFailure{
+			URL:     tokenList.TokenListURL,
+			ChainID: chainID,
+			Err:     err,
+		})
+		return true
+	}
+
 	contractInfoMap := map[uint64][]ContractInfo{}
 
 	// first include external token sources, as other lists will override to take
@@ -381,11 +763,15 @@ func (d *TokenDirectory) FetchTokenContractInfo(ctx context.Context, index Token
 	if ok {
 		for _, tokenList := range externalList {
 			contractInfoList := tokenList.Tokens
+			if slices.ContainsFunc(contractInfoList, func(ci ContractInfo) bool { return ci.ChainID == 0 }) {
+				err := fmt.Errorf("tokendirectory: token list contains token with chainID 0: %s", tokenList.TokenListURL)
+				if skip(tokenList, 0, err) {
+					continue
+				}
+				return nil, err
+			}
 			for _, ci := range contractInfoList {
 				chainID := ci.ChainID
-				if chainID == 0 {
-					return nil, fmt.Errorf("tokendirectory: token list contains token with chainID 0: %s", tokenList.TokenListURL)
-				}
 				if _, ok := contractInfoMap[chainID]; !ok {
 					contractInfoMap[chainID] = []ContractInfo{}
 				}
@@ -401,10 +787,12 @@ func (d *TokenDirectory) FetchTokenContractInfo(ctx context.Context, index Token
 		}
 		for _, tokenList := range tokenLists {
 			contractInfoList := tokenList.Tokens
-			for _, ci := range contractInfoList {
-				if ci.ChainID == 0 {
-					return nil, fmt.Errorf("tokendirectory: token list contains token with chainID 0: %s", tokenList.TokenListURL)
+			if slices.ContainsFunc(contractInfoList, func(ci ContractInfo) bool { return ci.ChainID == 0 }) {
+				err := fmt.Errorf("tokendirectory: token list contains token with chainID 0: %s", tokenList.TokenListURL)
+				if skip(tokenList, tokenListChainID, err) {
+					continue
 				}
+				return nil, err
 			}
 			if _, ok := contractInfoMap[tokenListChainID]; !ok {
 				contractInfoMap[tokenListChainID] = contractInfoList
@@ -419,12 +807,12 @@ func (d *TokenDirectory) FetchTokenContractInfo(ctx context.Context, index Token
 		uniqueMap := map[string]ContractInfo{}
 		for _, ci := range contractInfos {
 			key := fmt.Sprintf("%d-%s", ci.ChainID, ci.Address)
-			if ci.Address == "0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee" {
+			if ci.Address == nativeAliasAddress {
 				// we skip the 0xee..ee entry, as we assume there is a 0x00..00 entry
 				// and prefer to avoid duplicates for the native token
 				continue
 			}
-			if ci.Address == "0x0000000000000000000000000000000000000000" {
+			if ci.Address == nativeAddress {
 				ci.Extensions.Featured = true
 				ci.Extensions.FeatureIndex = -1000000 // ensure native tokens are always at the top
 			}
@@ -435,6 +823,11 @@ func (d *TokenDirectory) FetchTokenContractInfo(ctx context.Context, index Token
 		}
 		uniqueList := []ContractInfo{}
 		for _, ci := range uniqueMap {
+			// the filter applies to the merged tokens, so a chain token list
+			// excluding a token is not undone by an external token list
+			if d.options.ContractInfoFilter != nil && !d.options.ContractInfoFilter.Match(ci) {
+				continue
+			}
 			uniqueList = append(uniqueList, ci)
 		}
 		sort.Slice(uniqueList, func(i, j int) bool {
@@ -448,6 +841,9 @@ func (d *TokenDirectory) FetchTokenContractInfo(ctx context.Context, index Token
 		contractInfoMap[chainID] = uniqueList
 	}
 
+	if partialErr != nil {
+		return contractInfoMap, partialErr
+	}
 	return contractInfoMap, nil
 }
 
@@ -496,33 +892,68 @@ func (d *TokenDirectory) GetExternalTokenListURLs(ctx context.Context) ([]string
 
 func (d *TokenDirectory) FetchTokenList(ctx context.Context, tokenListURL string) (TokenList, error) {
 	var expectedContentHash string
-	if fallbackURLFor(tokenListURL) != tokenListURL {
-		if hash, ok, err := d.GetContentHashForTokenList(ctx, tokenListURL); err == nil && ok {
-			expectedContentHash = hash
-		}
+	if hash, ok, err := d.GetContentHashForTokenList(ctx, tokenListURL); err == nil && ok {
+		expectedContentHash = hash
 	}
 	return d.fetchTokenList(ctx, tokenListURL, expectedContentHash)
 }
 
 func (d *TokenDirectory) fetchTokenList(ctx context.Context, tokenListURL string, expectedContentHash string) (TokenList, error) {
+	tokenList, err := d.loadTokenList(ctx, tokenListURL, expectedContentHash)
+	if err != nil {
+		return TokenList{}, err
+	}
+	return d.filterTokenList(ctx, tokenList), nil
+}
+
+// loadTokenList returns the normalized token list, sharing a load of the
+// same token list already in flight rather than loading it again.
+func (d *TokenDirectory) loadTokenList(ctx context.Context, tokenListURL string, expectedContentHash string) (TokenList, error) {
+	// spaces are not valid in URLs, so the key is unambiguous
+	key := tokenListURL + " " + expectedContentHash
+	return d.tokenListFlight.do(ctx, key, func(ctx context.Context) (TokenList, error) {
+		return d.loadTokenListOnce(ctx, tokenListURL, expectedContentHash)
+	})
+}
+
+// loadTokenListOnce returns the normalized token list, looking it up in the
+// cache, then in the cache dir, and finally fetching it from the remote
+// source.
+func (d *TokenDirectory) loadTokenListOnce(ctx context.Context, tokenListURL string, expectedContentHash string) (TokenList, error) {
+	var indexedContentHash string
 	if d.UseCache() {
-		d.mu.Lock()
-		tokenList, ok := d.tokenListCache[tokenListURL]
-		d.mu.Unlock()
+		indexedContentHash = expectedContentHash
+		if indexedContentHash == "" {
+			// only token lists in the index have a known content hash, and
+			// failing to fetch the index is treated as a cache miss
+			indexedContentHash, _, _ = d.GetContentHashForTokenList(ctx, tokenListURL)
+		}
+	}
+
+	if indexedContentHash != "" {
+		// a cached token list may be older than the one last fetched, eg.
+		// when the index was rolled back, and is then treated as a cache
+		// miss
+		tokenList, ok, err := d.cache.Get(ctx, tokenListURL, indexedContentHash)
+		if err == nil && ok && d.checkVersion(tokenListURL, tokenList.Version) == nil && d.checkCachedSchema(&tokenList) == nil {
+			// the cache may be backed by a serialized store, which drops
+			// the fields that are not part of the token list JSON
+			tokenList.TokenListURL = tokenListURL
+			tokenList.ContentHash = indexedContentHash
+			d.recordVersion(tokenListURL, tokenList.Version)
+			return tokenList, nil
+		}
 
-		if ok && tokenList.ContentHash != "" {
-			indexedContentHash := expectedContentHash
-			indexedContentHashFound := indexedContentHash != ""
-			if !indexedContentHashFound {
-				var err error
-				indexedContentHash, indexedContentHashFound, err = d.GetContentHashForTokenList(ctx, tokenListURL)
-				if err != nil {
-					return TokenList{}, fmt.Errorf("tokendirectory: failed to get content hash for token list %s: %w", tokenListURL, err)
+		if d.diskCache != nil {
+			if buf, ok := d.diskCache.readTokenList(tokenListURL, indexedContentHash); ok {
+				// the cache dir may be shared with processes using other
+				// options, so the token list is validated again, and a
+				// token list which is rejected is treated as a cache miss
+				var tokenList TokenList
+				if err := json.Unmarshal(buf, &tokenList); err == nil && d.checkSchema(&tokenList) == nil && d.checkVersion(tokenListURL, tokenList.Version) == nil {
+					return d.storeTokenList(ctx, tokenListURL, indexedContentHash, tokenList), nil
 				}
 			}
-			if indexedContentHashFound && tokenList.ContentHash == indexedContentHash {
-				return tokenList, nil
-			}
 		}
 	}
 
@@ -535,31 +966,143 @@ func (d *TokenDirectory) fetchTokenList(ctx context.Context, tokenListURL string
 		}
 		candidateHash := sha256Hash(buf)
 		if expectedContentHash != "" && candidateHash != expectedContentHash {
-			return fmt.Errorf("content hash mismatch: expected %s, got %s", expectedContentHash, candidateHash)
+			return &HashMismatchError{URL: tokenListURL, Expected: expectedContentHash, Got: candidateHash}
+		}
+		if err := d.checkSchema(&candidate); err != nil {
+			return err
+		}
+		if err := d.checkVersion(tokenListURL, candidate.Version); err != nil {
+			return err
 		}
 		tokenList = candidate
 		contentHash = candidateHash
 		return nil
 	}
 
+	var buf []byte
 	var err error
-	if fallback := fallbackURLFor(tokenListURL); fallback != tokenListURL {
-		_, err = d.fetchManagedURLs(ctx, tokenListURL, fallback, false, validateTokenList)
+	group, file, managed := d.locateTokenList(ctx, tokenListURL)
+	if managed {
+		buf, err = d.fetchManaged(ctx, false, group, file, validateTokenList)
 	} else {
-		_, err = d.fetchFromSources(ctx, validateTokenList, fetchSource{url: tokenListURL})
+		buf, err = d.fetchFromURLs(ctx, validateTokenList, tokenListURL)
+	}
+	if err != nil && managed && d.options.Snapshot != nil {
+		tokenList, snapshotErr := d.fetchSnapshotTokenList(ctx, tokenListURL, group, file)
+		if snapshotErr == nil {
+			return tokenList, nil
+		}
+		err = errors.Join(err, snapshotErr)
 	}
 	if err != nil {
 		return TokenList{}, fmt.Errorf("tokendirectory: failed to fetch token list %s: %w", tokenListURL, err)
 	}
 
+	if d.UseCache() && d.diskCache != nil {
+		// persisting is best effort, the token list is still usable in memory
+		_ = d.diskCache.writeTokenList(tokenListURL, contentHash, buf)
+	}
+
+	return d.storeTokenList(ctx, tokenListURL, contentHash, tokenList), nil
+}
+
+// fetchSnapshotTokenList fetches the token list from the last-resort
+// snapshot source, marked as stale. The snapshot may predate the index, so
+// its content hash is not checked against the index.
+func (d *TokenDirectory) fetchSnapshotTokenList(ctx context.Context, tokenListURL string, group string, file string) (TokenList, error) {
+	snapshotURL := d.options.Snapshot.TokenListURL(group, file)
+	buf, err := d.options.Snapshot.FetchTokenList(ctx, group, file)
+	if err != nil {
+		return TokenList{}, fmt.Errorf("fetching snapshot %s: %w", snapshotURL, err)
+	}
+	var tokenList TokenList
+	if err := json.Unmarshal(buf, &tokenList); err != nil {
+		return TokenList{}, fmt.Errorf("fetching snapshot %s: unmarshalling token list: %w", snapshotURL, err)
+	}
+	if err := d.checkSchema(&tokenList); err != nil {
+		return TokenList{}, fmt.Errorf("fetching snapshot %s: %w", snapshotURL, err)
+	}
+	if err := d.checkVersion(tokenListURL, tokenList.Version); err != nil {
+		return TokenList{}, fmt.Errorf("fetching snapshot %s: %w", snapshotURL, err)
+	}
+	tokenList.TokenListURL = tokenListURL
+	tokenList.ContentHash = sha256Hash(buf)
+	tokenList.Stale = true
+	normalizeTokenList(&tokenList)
+	return tokenList, nil
+}
+
+// storeTokenList normalizes a freshly decoded and validated token list and
+// stores it in the cache.
+func (d *TokenDirectory) storeTokenList(ctx context.Context, tokenListURL string, contentHash string, tokenList TokenList) TokenList {
 	tokenList.TokenListURL = tokenListURL
 	tokenList.ContentHash = contentHash
+	normalizeTokenList(&tokenList)
+	d.recordVersion(tokenListURL, tokenList.Version)
+
+	// Cache the token list if caching is enabled. Note: this will be evicted
+	// very quickly if the index is updated.
+	if d.UseCache() {
+		// caching is best effort, a failing cache only costs a refetch
+		_ = d.cache.Set(ctx, tokenListURL, contentHash, tokenList)
+	}
+
+	return tokenList
+}
+
+// checkVersion returns a *VersionDowngradeError if
+// Options.RejectVersionDowngrades is set and the version is lower than the
+// version of the token list last fetched from the URL.
+func (d *TokenDirectory) checkVersion(tokenListURL string, version *Version) error {
+	if !d.options.RejectVersionDowngrades || version == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cached, ok := d.tokenListVersions[tokenListURL]; ok && version.Less(cached) {
+		return &VersionDowngradeError{URL: tokenListURL, Cached: cached, Got: *version}
+	}
+	return nil
+}
 
+// recordVersion records the version of the token list last fetched from
+// the URL, for checkVersion.
+func (d *TokenDirectory) recordVersion(tokenListURL string, version *Version) {
+	if !d.options.RejectVersionDowngrades || version == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.tokenListVersions == nil {
+		d.tokenListVersions = map[string]Version{}
+	}
+	d.tokenListVersions[tokenListURL] = *version
+}
+
+// normalizeTokenList normalizes/downcases all contract addresses in the
+// token list, and trims the names and symbols of its tokens. Tokens without
+// a type take the token standard of the list, so it is not lost once the
+// tokens are merged.
+func normalizeTokenList(tokenList *TokenList) {
+	for i, token := range tokenList.Tokens {
+		tokenList.Tokens[i].Address = strings.ToLower(token.Address)
+		tokenList.Tokens[i].Name = strings.TrimSpace(token.Name)
+		tokenList.Tokens[i].Symbol = strings.TrimSpace(token.Symbol)
+		if token.Type == "" {
+			tokenList.Tokens[i].Type = tokenList.TokenStandard
+		}
+	}
+}
+
+// filterTokenList annotates a token list with its index metadata and
+// filters its tokens according to the options. The given token list may be
+// shared with the cache, so it is never modified in place.
+func (d *TokenDirectory) filterTokenList(ctx context.Context, tokenList TokenList) TokenList {
 	var deprecated bool
 	index, _ := d.fetchIndex(ctx)
 	for _, entries := range index {
 		for _, entry := range entries {
-			if entry.TokenListURL == tokenListURL {
+			if entry.TokenListURL == tokenList.TokenListURL {
 				deprecated = entry.Deprecated
 				break
 			}
@@ -592,22 +1135,19 @@ func (d *TokenDirectory) fetchTokenList(ctx context.Context, tokenListURL string
 		}
 	}
 
-	// normalize/downcase all contract addresses in the token list
-	for i, token := range tokenList.Tokens {
-		tokenList.Tokens[i].Address = strings.ToLower(token.Address)
-		tokenList.Tokens[i].Name = strings.TrimSpace(token.Name)
-		tokenList.Tokens[i].Symbol = strings.TrimSpace(token.Symbol)
-	}
-
-	// Cache the token list if caching is enabled. Note: this will be evicted
-	// very quickly if the index is updated.
-	if d.UseCache() {
-		d.mu.Lock()
-		d.tokenListCache[tokenListURL] = tokenList
-		d.mu.Unlock()
+	// The token lists of chains hold a single token standard, and were
+	// filtered by filename already. The external token lists mix them.
+	if len(d.options.TokenStandards) > 0 && tokenList.ChainID == 0 {
+		tokens := []ContractInfo{}
+		for _, token := range tokenList.Tokens {
+			if containsFold(d.options.TokenStandards, tokenStandardOf(token, tokenList)) {
+				tokens = append(tokens, token)
+			}
+		}
+		tokenList.Tokens = tokens
 	}
 
-	return tokenList, nil
+	return tokenList
 }
 
 func (d *TokenDirectory) UseCache() bool {
@@ -671,79 +1211,129 @@ func DiffIndex(index1, index2 TokenDirectoryIndex) TokenDirectoryIndex {
 	return out
 }
 
+// TokenDirectoryIndexURL returns the URL of the index in the default
+// primary source.
 func TokenDirectoryIndexURL() string {
-	return fmt.Sprintf("%s/index.json", tokenDirectoryBaseSourceURL)
+	return fmt.Sprintf("%s/index.json", DefaultSourceURL)
 }
 
+// TokenDirectoryTokenListURL returns the URL of a token list in the default
+// primary source, which identifies it unless Options.Sources is set.
 func TokenDirectoryTokenListURL(group string, file string) string {
-	return fmt.Sprintf("%s/%s/%s", tokenDirectoryBaseSourceURL, group, file)
+	return fmt.Sprintf("%s/%s/%s", DefaultSourceURL, group, file)
 }
 
+// TokenDirectoryFallbackIndexURL returns the URL of the index in the
+// default fallback source.
 func TokenDirectoryFallbackIndexURL() string {
-	return fmt.Sprintf("%s/index.json", tokenDirectoryFallbackSourceURL)
+	return fmt.Sprintf("%s/index.json", DefaultFallbackSourceURL)
 }
 
+// TokenDirectoryFallbackTokenListURL returns the URL of a token list in the
+// default fallback source.
 func TokenDirectoryFallbackTokenListURL(group string, file string) string {
-	return fmt.Sprintf("%s/%s/%s", tokenDirectoryFallbackSourceURL, group, file)
+	return fmt.Sprintf("%s/%s/%s", DefaultFallbackSourceURL, group, file)
+}
+
+// TokenListURL returns the URL identifying the token list file within the
+// given index group, as found in TokenDirectoryIndexEntry.TokenListURL.
+func (d *TokenDirectory) TokenListURL(group string, file string) string {
+	return d.sources[0].TokenListURL(group, file)
 }
 
-// fallbackURLFor returns the fallback (GCS mirror) URL for the given primary
-// (GitHub) URL. URLs not served from the primary source are returned unchanged.
-func fallbackURLFor(url string) string {
-	if rest, ok := strings.CutPrefix(url, tokenDirectoryBaseSourceURL); ok {
-		return tokenDirectoryFallbackSourceURL + rest
+// locateTokenList returns the index group and file of the token list with
+// the given URL, if it is served by the sources.
+func (d *TokenDirectory) locateTokenList(ctx context.Context, tokenListURL string) (string, string, bool) {
+	index, _ := d.fetchIndex(ctx)
+	for _, entries := range index {
+		for _, entry := range entries {
+			if entry.TokenListURL == tokenListURL && entry.Group != "" {
+				return entry.Group, entry.Filename, true
+			}
+		}
 	}
-	return url
+	// the token list may be filtered out of the index by the options, but
+	// it can still be located from the URL of a source serving it
+	for _, source := range d.sources {
+		if parser, ok := source.(tokenListURLParser); ok {
+			if group, file, ok := parser.parseTokenListURL(tokenListURL); ok {
+				return group, file, true
+			}
+		}
+	}
+	return "", "", false
 }
 
 type fetchSource struct {
-	url       string
-	isPrimary bool
+	url   string
+	fetch func(ctx context.Context) ([]byte, error)
+
+	// health is the index of the source in TokenDirectory.health, or -1 if
+	// its health is not tracked
+	health int
 }
 
 type responseValidator func([]byte) error
 
-// fetchManagedURLs fetches a primary/fallback pair. Index refreshes probe the
-// primary so it can recover; token-list requests prefer the fallback after a
-// primary failure until the next index refresh.
-func (d *TokenDirectory) fetchManagedURLs(
+// fetchManaged fetches the index, or the token list file within the given
+// index group, from the configured sources. Index refreshes probe the
+// sources in the configured order so that recovering sources are tried
+// again; token-list requests go to the healthiest sources first.
+func (d *TokenDirectory) fetchManaged(
 	ctx context.Context,
-	primaryURL string,
-	fallbackURL string,
-	probePrimary bool,
+	isIndex bool,
+	group string,
+	file string,
 	validate responseValidator,
 ) ([]byte, error) {
-	d.mu.Lock()
-	preferFallback := d.preferFallback
-	d.mu.Unlock()
-
-	sources := []fetchSource{
-		{url: primaryURL, isPrimary: true},
-		{url: fallbackURL},
+	order := d.sourcesByHealth()
+	if isIndex {
+		slices.Sort(order)
 	}
-	if preferFallback && !probePrimary {
-		slices.Reverse(sources)
+
+	sources := make([]fetchSource, len(order))
+	for i, health := range order {
+		source := d.sources[health]
+		if isIndex {
+			sources[i] = fetchSource{url: source.IndexURL(), fetch: source.FetchIndex, health: health}
+		} else {
+			sources[i] = fetchSource{
+				url: source.TokenListURL(group, file),
+				fetch: func(ctx context.Context) ([]byte, error) {
+					return source.FetchTokenList(ctx, group, file)
+				},
+				health: health,
+			}
+		}
 	}
 	return d.fetchFromSources(ctx, validate, sources...)
 }
 
 // fetchFromURLs fetches the given URLs in order and returns the body of the
-// first URL that responds with 200 OK. This is used to transparently fall
-// back to the GCS mirror when the primary GitHub source is unavailable
-// (e.g. rate limited, 5xx, stalled, or network errors). An error is returned
-// only if all URLs fail, joining the individual failures so no error is lost.
-func (d *TokenDirectory) fetchFromURLs(ctx context.Context, urls ...string) ([]byte, error) {
+// first URL that responds with 200 OK and passes validation. It is used for
+// token lists outside of the token directory. An error is returned only if
+// all URLs fail, joining the individual failures so no error is lost.
+func (d *TokenDirectory) fetchFromURLs(ctx context.Context, validate responseValidator, urls ...string) ([]byte, error) {
 	sources := make([]fetchSource, len(urls))
 	for i, url := range urls {
-		sources[i] = fetchSource{url: url}
+		sources[i] = fetchSource{
+			url: url,
+			fetch: func(ctx context.Context) ([]byte, error) {
+				return fetchURL(ctx, d.client, url)
+			},
+			health: -1,
+		}
 	}
-	return d.fetchFromSources(ctx, nil, sources...)
+	return d.fetchFromSources(ctx, validate, sources...)
 }
 
 func (d *TokenDirectory) fetchFromSources(ctx context.Context, validate responseValidator, sources ...fetchSource) ([]byte, error) {
 	if len(sources) == 0 {
 		return nil, fmt.Errorf("no urls provided")
 	}
+	if d.options.HedgeDelay > 0 && len(sources) > 1 {
+		return d.fetchHedged(ctx, validate, sources)
+	}
 	var errs []error
 	for _, source := range sources {
 		// bail out early if the caller canceled or timed out, keeping the
@@ -752,68 +1342,136 @@ func (d *TokenDirectory) fetchFromSources(ctx context.Context, validate response
 			return nil, errors.Join(append(errs, err)...)
 		}
 
-		attemptCtx := ctx
-		cancel := func() {}
-		if len(sources) > 1 {
-			// Give failover sources their own budgets. A single arbitrary URL
-			// continues to honor only the caller context and configured client.
-			attemptCtx, cancel = context.WithTimeout(ctx, sourceAttemptTimeout)
-		}
-		buf, err := d.fetchOnce(attemptCtx, source.url)
-		if err == nil && validate != nil {
-			if validationErr := validate(buf); validationErr != nil {
-				err = fmt.Errorf("validating response: %w", validationErr)
-			}
-		}
-		cancel()
+		// Give failover sources their own budgets. A single arbitrary URL
+		// continues to honor only the caller context and configured client.
+		buf, err := d.fetchAttempt(ctx, validate, source, len(sources) > 1)
 		if err == nil {
-			if source.isPrimary {
-				d.mu.Lock()
-				d.preferFallback = false
-				d.mu.Unlock()
-			}
 			return buf, nil
 		}
-		if source.isPrimary && ctx.Err() == nil {
-			d.mu.Lock()
-			d.preferFallback = true
-			d.mu.Unlock()
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("%w: %w", ErrAllSourcesFailed, errors.Join(errs...))
+}
+
+// fetchAttempt fetches and validates the response of a single source,
+// within its own budget if requested, and records the outcome in the health
+// of the source.
+func (d *TokenDirectory) fetchAttempt(ctx context.Context, validate responseValidator, source fetchSource, budget bool) ([]byte, error) {
+	attemptCtx := ctx
+	cancel := func() {}
+	if budget {
+		attemptCtx, cancel = context.WithTimeout(ctx, sourceAttemptTimeout)
+	}
+	start := time.Now()
+	buf, err := source.fetch(attemptCtx)
+	latency := time.Since(start)
+	if err == nil && validate != nil {
+		if validationErr := validate(buf); validationErr != nil {
+			err = &ValidationError{URL: source.url, Err: validationErr}
 		}
-		// if the attempt timed out but the caller's context is still alive,
-		// surface a source timeout rather than the attempt's deadline, so
-		// callers don't mistake it for their own budget being spent
-		if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
-			err = fmt.Errorf("%w: %v", ErrSourceTimeout, err)
+	}
+	cancel()
+	if err == nil {
+		if source.health >= 0 {
+			d.recordSourceSuccess(source.health, latency)
 		}
-		errs = append(errs, fmt.Errorf("fetching %s: %w", source.url, err))
+		return buf, nil
+	}
+	// the caller giving up says nothing about the health of the source
+	if source.health >= 0 && ctx.Err() == nil {
+		d.recordSourceFailure(source.health)
+	}
+	// if the attempt timed out but the caller's context is still alive,
+	// surface a source timeout rather than the attempt's deadline, so
+	// callers don't mistake it for their own budget being spent
+	if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		err = newSourceTimeoutError(err)
 	}
-	return nil, errors.Join(errs...)
+	return nil, newSourceError(source.url, err)
 }
 
-// fetchOnce fetches a single URL and returns its body if it responds with
-// 200 OK. The body is fully read before returning, so the caller may cancel
-// the context afterwards.
-func (d *TokenDirectory) fetchOnce(ctx context.Context, url string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+// errHedgeLost is returned to the hedged requests which complete after
+// another request already won.
+var errHedgeLost = errors.New("another source responded first")
+
+// fetchHedged fetches from the sources in order, but starts the next
+// source whenever the pending ones have not responded within
+// Options.HedgeDelay, or as soon as one fails. The first response passing
+// validation wins and the other requests are canceled.
+func (d *TokenDirectory) fetchHedged(ctx context.Context, validate responseValidator, sources []fetchSource) ([]byte, error) {
+	hedgeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// validators record the response they accept, so they are never run
+	// concurrently, and never once a winner has been picked
+	var validateMu sync.Mutex
+	done := false
+	hedgedValidate := func(buf []byte) error {
+		validateMu.Lock()
+		defer validateMu.Unlock()
+		if done {
+			return errHedgeLost
+		}
+		if validate != nil {
+			if err := validate(buf); err != nil {
+				return err
+			}
+		}
+		done = true
+		// cancel the losers before they can see errHedgeLost, so they are
+		// not recorded as failures
+		cancel()
+		return nil
 	}
-	res, err := d.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request: %w", err)
+	defer func() {
+		validateMu.Lock()
+		done = true
+		validateMu.Unlock()
+	}()
+
+	type result struct {
+		i   int
+		buf []byte
+		err error
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		// drain the body so the connection can be reused
-		_, _ = io.Copy(io.Discard, res.Body)
-		return nil, fmt.Errorf("status %s", res.Status)
+	results := make(chan result, len(sources))
+	errs := make([]error, len(sources))
+	next, pending := 0, 0
+
+	timer := time.NewTimer(d.options.HedgeDelay)
+	defer timer.Stop()
+	launch := func() {
+		i := next
+		next++
+		pending++
+		go func() {
+			buf, err := d.fetchAttempt(hedgeCtx, hedgedValidate, sources[i], true)
+			results <- result{i: i, buf: buf, err: err}
+		}()
+		timer.Reset(d.options.HedgeDelay)
 	}
-	buf, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("reading body: %w", err)
+
+	launch()
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.buf, nil
+			}
+			errs[r.i] = r.err
+			if next < len(sources) && ctx.Err() == nil {
+				launch()
+			}
+		case <-timer.C:
+			if next < len(sources) {
+				launch()
+			}
+		case <-ctx.Done():
+			return nil, errors.Join(append(errs, ctx.Err())...)
+		}
 	}
-	return buf, nil
+	return nil, fmt.Errorf("%w: %w", ErrAllSourcesFailed, errors.Join(errs...))
 }
 
 func filteredIndex(index TokenDirectoryIndex, filter *IndexFilter) TokenDirectoryIndex {
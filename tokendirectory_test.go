@@ -2,13 +2,17 @@ package tokendirectory
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -84,19 +88,13 @@ func (ts *testServer) requestPaths() []string {
 	return slices.Clone(ts.paths)
 }
 
-// withTestSources overrides the primary and fallback base URLs with the given
-// test servers for the duration of the test. Tests using this must not run in
-// parallel.
-func withTestSources(t *testing.T, primary, fallback *testServer) {
-	t.Helper()
-	oldBase := tokenDirectoryBaseSourceURL
-	oldFallback := tokenDirectoryFallbackSourceURL
-	tokenDirectoryBaseSourceURL = primary.URL
-	tokenDirectoryFallbackSourceURL = fallback.URL
-	t.Cleanup(func() {
-		tokenDirectoryBaseSourceURL = oldBase
-		tokenDirectoryFallbackSourceURL = oldFallback
-	})
+// testSources returns HTTP sources serving from the given primary and
+// fallback test servers.
+func testSources(primary, fallback *testServer) []Source {
+	return []Source{
+		NewHTTPSource(primary.URL, nil),
+		NewHTTPSource(fallback.URL, nil),
+	}
 }
 
 func TestFetchFromURLs(t *testing.T) {
@@ -109,7 +107,7 @@ func TestFetchFromURLs(t *testing.T) {
 		fallback := newTestServer(t, http.StatusOK, "fallback-body")
 		defer fallback.Close()
 
-		buf, err := td.fetchFromURLs(ctx, primary.URL, fallback.URL)
+		buf, err := td.fetchFromURLs(ctx, nil, primary.URL, fallback.URL)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -127,7 +125,7 @@ func TestFetchFromURLs(t *testing.T) {
 		fallback := newTestServer(t, http.StatusOK, "fallback-body")
 		defer fallback.Close()
 
-		buf, err := td.fetchFromURLs(ctx, primary.URL, fallback.URL)
+		buf, err := td.fetchFromURLs(ctx, nil, primary.URL, fallback.URL)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -142,7 +140,7 @@ func TestFetchFromURLs(t *testing.T) {
 		fallback := newTestServer(t, http.StatusOK, "fallback-body")
 		defer fallback.Close()
 
-		buf, err := td.fetchFromURLs(ctx, primary.URL, fallback.URL)
+		buf, err := td.fetchFromURLs(ctx, nil, primary.URL, fallback.URL)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -158,7 +156,7 @@ func TestFetchFromURLs(t *testing.T) {
 		fallback := newTestServer(t, http.StatusOK, "fallback-body")
 		defer fallback.Close()
 
-		buf, err := td.fetchFromURLs(ctx, closedURL, fallback.URL)
+		buf, err := td.fetchFromURLs(ctx, nil, closedURL, fallback.URL)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -182,7 +180,7 @@ func TestFetchFromURLs(t *testing.T) {
 		defer fallback.Close()
 
 		start := time.Now()
-		buf, err := td.fetchFromURLs(ctx, primary.URL, fallback.URL)
+		buf, err := td.fetchFromURLs(ctx, nil, primary.URL, fallback.URL)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -214,7 +212,7 @@ func TestFetchFromURLs(t *testing.T) {
 		fallback := stall()
 		defer fallback.Close()
 
-		_, err := td.fetchFromURLs(ctx, primary.URL, fallback.URL)
+		_, err := td.fetchFromURLs(ctx, nil, primary.URL, fallback.URL)
 		if err == nil {
 			t.Fatal("expected error when all sources stall")
 		}
@@ -236,7 +234,7 @@ func TestFetchFromURLs(t *testing.T) {
 		cancelledCtx, cancel := context.WithCancel(context.Background())
 		cancel()
 
-		if _, err := td.fetchFromURLs(cancelledCtx, primary.URL, fallback.URL); err == nil {
+		if _, err := td.fetchFromURLs(cancelledCtx, nil, primary.URL, fallback.URL); err == nil {
 			t.Fatal("expected error with canceled context")
 		}
 		if primary.hitCount() != 0 || fallback.hitCount() != 0 {
@@ -250,7 +248,7 @@ func TestFetchFromURLs(t *testing.T) {
 		fallback := newTestServer(t, http.StatusNotFound, "")
 		defer fallback.Close()
 
-		_, err := td.fetchFromURLs(ctx, primary.URL, fallback.URL)
+		_, err := td.fetchFromURLs(ctx, nil, primary.URL, fallback.URL)
 		if err == nil {
 			t.Fatal("expected error when all URLs fail")
 		}
@@ -261,7 +259,7 @@ func TestFetchFromURLs(t *testing.T) {
 	})
 
 	t.Run("no urls", func(t *testing.T) {
-		if _, err := td.fetchFromURLs(ctx); err == nil {
+		if _, err := td.fetchFromURLs(ctx, nil); err == nil {
 			t.Fatal("expected error when no urls provided")
 		}
 	})
@@ -277,7 +275,7 @@ func TestFetchFromURLs(t *testing.T) {
 		})
 		defer server.Close()
 
-		buf, err := td.fetchFromURLs(ctx, server.URL)
+		buf, err := td.fetchFromURLs(ctx, nil, server.URL)
 		if err != nil {
 			t.Fatalf("single URL should honor the caller context, got: %v", err)
 		}
@@ -309,37 +307,67 @@ func TestCallerCancellationDoesNotMarkPrimaryUnavailable(t *testing.T) {
 	fallback := newTestServer(t, http.StatusOK, "fallback-body")
 	defer fallback.Close()
 
-	td := NewTokenDirectory()
-	_, err := td.fetchManagedURLs(ctx, primary.URL, fallback.URL, false, nil)
+	td := NewTokenDirectory(Options{Sources: testSources(primary, fallback)})
+	_, err := td.fetchManaged(ctx, false, "mainnet", "erc20.json", nil)
 	if !errors.Is(err, context.Canceled) {
 		t.Fatalf("expected caller cancellation, got: %v", err)
 	}
 	if fallback.hitCount() != 0 {
 		t.Fatalf("expected caller cancellation to prevent fallback, got %d hits", fallback.hitCount())
 	}
-	td.mu.Lock()
-	preferFallback := td.preferFallback
-	td.mu.Unlock()
-	if preferFallback {
+	if health := td.SourceHealth()[0]; health.ConsecutiveFailures != 0 || health.CircuitOpen() {
 		t.Fatal("caller cancellation should not mark the primary unavailable")
 	}
 }
 
-func TestFallbackURLFor(t *testing.T) {
-	if got := fallbackURLFor(TokenDirectoryTokenListURL("mainnet", "erc20.json")); got != TokenDirectoryFallbackTokenListURL("mainnet", "erc20.json") {
-		t.Fatalf("unexpected fallback token list URL: %s", got)
+func TestParseTokenListURL(t *testing.T) {
+	sources := DefaultSources(nil)
+	primary, fallback := sources[0].(*HTTPSource), sources[1].(*HTTPSource)
+
+	if got := primary.TokenListURL("mainnet", "erc20.json"); got != TokenDirectoryTokenListURL("mainnet", "erc20.json") {
+		t.Fatalf("unexpected primary token list URL: %s", got)
 	}
-	if got := fallbackURLFor(TokenDirectoryIndexURL()); got != TokenDirectoryFallbackIndexURL() {
+	if got := fallback.IndexURL(); got != TokenDirectoryFallbackIndexURL() {
 		t.Fatalf("unexpected fallback index URL: %s", got)
 	}
-	other := "https://example.com/some/list.json"
-	if got := fallbackURLFor(other); got != other {
-		t.Fatalf("expected non-primary URL unchanged, got %s", got)
+	for _, source := range sources {
+		group, file, ok := source.(*HTTPSource).parseTokenListURL(source.TokenListURL("mainnet", "erc20.json"))
+		if !ok || group != "mainnet" || file != "erc20.json" {
+			t.Fatalf("unexpected location: %q %q %v", group, file, ok)
+		}
 	}
-	// only the prefix should be rewritten, not occurrences elsewhere in the URL
-	embedded := "https://example.com/proxy?u=" + TokenDirectoryTokenListURL("mainnet", "erc20.json")
-	if got := fallbackURLFor(embedded); got != embedded {
-		t.Fatalf("expected URL with embedded primary URL unchanged, got %s", got)
+	for _, url := range []string{
+		"https://example.com/some/list.json",
+		TokenDirectoryIndexURL(),
+		// only the prefix should match, not occurrences elsewhere in the URL
+		"https://example.com/proxy?u=" + TokenDirectoryTokenListURL("mainnet", "erc20.json"),
+	} {
+		if _, _, ok := primary.parseTokenListURL(url); ok {
+			t.Fatalf("expected %s not to be located", url)
+		}
+	}
+}
+
+func TestIndependentSources(t *testing.T) {
+	ctx := context.Background()
+	a := newTestServer(t, http.StatusOK, testIndexJSON)
+	defer a.Close()
+	b := newTestServer(t, http.StatusOK, testIndexJSON)
+	defer b.Close()
+
+	tdA := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(a.URL, nil)}})
+	tdB := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(b.URL, nil)}})
+	for _, td := range []*TokenDirectory{tdA, tdB} {
+		index, err := td.FetchIndex(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if url := index[1][0].TokenListURL; url != td.TokenListURL("mainnet", "erc20.json") {
+			t.Fatalf("expected token list URL from the configured source, got %s", url)
+		}
+	}
+	if a.hitCount() != 1 || b.hitCount() != 1 {
+		t.Fatalf("expected each directory to use its own source, got %d/%d hits", a.hitCount(), b.hitCount())
 	}
 }
 
@@ -351,9 +379,9 @@ func TestFetchIndexFallback(t *testing.T) {
 		defer primary.Close()
 		fallback := newTestServer(t, http.StatusOK, testIndexJSON)
 		defer fallback.Close()
-		withTestSources(t, primary, fallback)
+		sources := testSources(primary, fallback)
 
-		td := NewTokenDirectory()
+		td := NewTokenDirectory(Options{Sources: sources})
 		index, err := td.FetchIndex(ctx)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
@@ -374,9 +402,9 @@ func TestFetchIndexFallback(t *testing.T) {
 		defer primary.Close()
 		fallback := newTestServer(t, http.StatusOK, testIndexJSON)
 		defer fallback.Close()
-		withTestSources(t, primary, fallback)
+		sources := testSources(primary, fallback)
 
-		td := NewTokenDirectory()
+		td := NewTokenDirectory(Options{Sources: sources})
 		index, err := td.FetchIndex(ctx)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
@@ -397,9 +425,9 @@ func TestFetchIndexFallback(t *testing.T) {
 		defer primary.Close()
 		fallback := newTestServer(t, http.StatusOK, testIndexJSON)
 		defer fallback.Close()
-		withTestSources(t, primary, fallback)
+		sources := testSources(primary, fallback)
 
-		td := NewTokenDirectory()
+		td := NewTokenDirectory(Options{Sources: sources})
 		index, err := td.FetchIndex(ctx)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
@@ -427,10 +455,10 @@ func TestFetchTokenListFallback(t *testing.T) {
 			_, _ = w.Write([]byte(testTokenListJSON))
 		})
 		defer fallback.Close()
-		withTestSources(t, primary, fallback)
+		sources := testSources(primary, fallback)
 
-		td := NewTokenDirectory()
-		url := TokenDirectoryTokenListURL("mainnet", "erc20.json")
+		td := NewTokenDirectory(Options{Sources: sources})
+		url := sources[0].TokenListURL("mainnet", "erc20.json")
 		tokenList, err := td.FetchTokenList(ctx, url)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
@@ -460,10 +488,10 @@ func TestFetchTokenListFallback(t *testing.T) {
 		defer primary.Close()
 		fallback := newTestServer(t, http.StatusOK, testTokenListJSON)
 		defer fallback.Close()
-		withTestSources(t, primary, fallback)
+		sources := testSources(primary, fallback)
 
-		td := NewTokenDirectory()
-		url := TokenDirectoryTokenListURL("mainnet", "erc20.json")
+		td := NewTokenDirectory(Options{Sources: sources})
+		url := sources[0].TokenListURL("mainnet", "erc20.json")
 		tokenList, err := td.FetchTokenList(ctx, url)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
@@ -476,3 +504,480 @@ func TestFetchTokenListFallback(t *testing.T) {
 		}
 	})
 }
+
+func TestFetchIndexConditional(t *testing.T) {
+	ctx := context.Background()
+	var notModified int
+	primary := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") != "" {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		_, _ = w.Write([]byte(testIndexJSON))
+	})
+	defer primary.Close()
+	fallback := newTestServer(t, http.StatusInternalServerError, "")
+	defer fallback.Close()
+	sources := testSources(primary, fallback)
+
+	td := NewTokenDirectory(Options{Sources: sources})
+	for i := 0; i < 2; i++ {
+		// expire the memoized index so every iteration refreshes it
+		td.mu.Lock()
+		td.indexFetchedAt = time.Time{}
+		td.mu.Unlock()
+
+		index, err := td.FetchIndex(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(index[1]) != 1 {
+			t.Fatalf("expected 1 entry for chain 1, got %d", len(index[1]))
+		}
+	}
+	if primary.hitCount() != 2 || notModified != 1 {
+		t.Fatalf("expected the second refresh to be answered with 304, got %d hits and %d not modified", primary.hitCount(), notModified)
+	}
+}
+
+func TestFetchIndexStaleWhileRevalidate(t *testing.T) {
+	ctx := context.Background()
+	updatedIndexJSON := strings.Replace(testIndexJSON, `"tokenLists": {`, `"tokenLists": {
+        "erc721.json": "abc",`, 1)
+
+	var mu sync.Mutex
+	body := testIndexJSON
+	release := make(chan struct{})
+	primary := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		b := body
+		mu.Unlock()
+		if b != testIndexJSON {
+			<-release
+		}
+		_, _ = w.Write([]byte(b))
+	})
+	defer primary.Close()
+	fallback := newTestServer(t, http.StatusInternalServerError, "")
+	defer fallback.Close()
+	sources := testSources(primary, fallback)
+
+	td := NewTokenDirectory(Options{Sources: sources, IndexTTL: 20 * time.Millisecond, IndexMaxStale: time.Hour})
+	if _, err := td.FetchIndex(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	mu.Lock()
+	body = updatedIndexJSON
+	mu.Unlock()
+
+	// the expired index is served right away while the refresh is stalled
+	index, err := td.FetchIndex(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(index[1]) != 1 {
+		t.Fatalf("expected the stale index, got %d entries", len(index[1]))
+	}
+
+	// further callers must not start another refresh while one is running
+	for i := 0; i < 3; i++ {
+		if _, err := td.FetchIndex(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if primary.hitCount() != 2 {
+		t.Fatalf("expected a single background refresh, got %d hits", primary.hitCount())
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(index[1]) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the background refresh to update the index")
+		}
+		time.Sleep(10 * time.Millisecond)
+		if index, err = td.FetchIndex(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestFetchIndexMaxStale(t *testing.T) {
+	ctx := context.Background()
+	primary := newTestServer(t, http.StatusOK, testIndexJSON)
+	defer primary.Close()
+	fallback := newTestServer(t, http.StatusInternalServerError, "")
+	defer fallback.Close()
+	sources := testSources(primary, fallback)
+
+	td := NewTokenDirectory(Options{Sources: sources, IndexTTL: 10 * time.Millisecond, IndexMaxStale: 10 * time.Millisecond})
+	if _, err := td.FetchIndex(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// past the max-stale limit the caller waits for the refresh
+	if _, err := td.FetchIndex(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if primary.hitCount() != 2 {
+		t.Fatalf("expected a synchronous refresh, got %d hits", primary.hitCount())
+	}
+	td.mu.Lock()
+	refreshing := td.indexRefreshing
+	td.mu.Unlock()
+	if refreshing {
+		t.Fatal("did not expect a background refresh past the max-stale limit")
+	}
+}
+
+func TestFetchIndexStaleRefreshTimeout(t *testing.T) {
+	ctx := context.Background()
+	oldTimeout := sourceAttemptTimeout
+	sourceAttemptTimeout = 100 * time.Millisecond
+	defer func() { sourceAttemptTimeout = oldTimeout }()
+
+	// the second request, ie. the first background refresh, hangs
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 2 {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		_, _ = w.Write([]byte(testIndexJSON))
+	})
+	defer server.Close()
+	defer close(release)
+
+	td := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(server.URL, nil)}, IndexTTL: 10 * time.Millisecond, IndexMaxStale: time.Hour})
+	if _, err := td.FetchIndex(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for server.hitCount() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the hung refresh to time out and a new one to be made, got %d hits", server.hitCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+		if _, err := td.FetchIndex(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// let the last background refresh finish before restoring the timeout
+	for {
+		td.mu.Lock()
+		refreshing := td.indexRefreshing
+		td.mu.Unlock()
+		if !refreshing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSnapshotFallback(t *testing.T) {
+	ctx := context.Background()
+	primary := newTestServer(t, http.StatusServiceUnavailable, "")
+	defer primary.Close()
+	fallback := newTestServer(t, http.StatusServiceUnavailable, "")
+	defer fallback.Close()
+
+	t.Run("no snapshot", func(t *testing.T) {
+		td := NewTokenDirectory(Options{Sources: testSources(primary, fallback)})
+		if _, err := td.FetchIndex(ctx); err == nil {
+			t.Fatal("expected error when all sources fail")
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		td := NewTokenDirectory(Options{
+			Sources:  testSources(primary, fallback),
+			Snapshot: NewFSSource(testFS(testTokenListJSON)),
+		})
+		index, err := td.FetchIndex(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(index[1]) != 1 || !index[1][0].Stale {
+			t.Fatalf("expected a stale index entry, got %+v", index[1])
+		}
+		if index[1][0].TokenListURL != td.TokenListURL("mainnet", "erc20.json") {
+			t.Fatalf("expected token lists to be identified by the primary source, got %s", index[1][0].TokenListURL)
+		}
+
+		tokenLists, err := td.FetchChainTokenLists(ctx, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(tokenLists) != 1 || !tokenLists[0].Stale || len(tokenLists[0].Tokens) != 1 {
+			t.Fatalf("expected a stale token list, got %+v", tokenLists)
+		}
+		if _, ok, _ := td.cache.Get(ctx, tokenLists[0].TokenListURL, tokenLists[0].ContentHash); ok {
+			t.Fatal("did not expect the stale token list to be cached")
+		}
+	})
+
+	t.Run("empty snapshot", func(t *testing.T) {
+		td := NewTokenDirectory(Options{
+			Sources:  testSources(primary, fallback),
+			Snapshot: NewFSSource(fstest.MapFS{"index/index.json": {Data: []byte(`{"index": {}}`)}}),
+		})
+		for range 2 {
+			_, err := td.FetchIndex(ctx)
+			if !errors.Is(err, ErrAllSourcesFailed) || !strings.Contains(err.Error(), "index.json is empty") {
+				t.Fatalf("expected the source and snapshot errors, got: %v", err)
+			}
+		}
+	})
+}
+
+func TestFetchTokenListsConcurrently(t *testing.T) {
+	ctx := context.Background()
+
+	// an index with several token lists on two chains
+	lists := map[string]string{}
+	index := map[string]any{}
+	for _, group := range []struct {
+		name    string
+		chainID uint64
+	}{{"mainnet", 1}, {"polygon", 137}} {
+		tokenLists := map[string]string{}
+		for i := range 4 {
+			file := fmt.Sprintf("list%d.json", i)
+			buf := fmt.Sprintf(`{"name":"%s %s","chainId":%d,"tokens":[]}`, group.name, file, group.chainID)
+			lists["/"+group.name+"/"+file] = buf
+			tokenLists[file] = sha256Hash([]byte(buf))
+		}
+		index[group.name] = map[string]any{"chainId": group.chainID, "tokenLists": tokenLists}
+	}
+	indexJSON, err := json.Marshal(map[string]any{"index": index})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newServer := func(failing string) (*testServer, *atomic.Int32) {
+		var inFlight, maxInFlight atomic.Int32
+		server := newHandlerTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/index.json" {
+				_, _ = w.Write(indexJSON)
+				return
+			}
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			if strings.HasPrefix(r.URL.Path, failing) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(lists[r.URL.Path]))
+		})
+		return server, &maxInFlight
+	}
+
+	t.Run("bounded and ordered", func(t *testing.T) {
+		server, maxInFlight := newServer("/none")
+		defer server.Close()
+
+		td := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(server.URL, nil)}, MaxConcurrency: 3})
+		tokenLists, err := td.FetchChainTokenLists(ctx, 137)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i, tokenList := range tokenLists {
+			if want := fmt.Sprintf("polygon list%d.json", i); tokenList.Name != want {
+				t.Fatalf("expected %q at %d, got %q", want, i, tokenList.Name)
+			}
+		}
+		if n := maxInFlight.Load(); n < 2 || n > 3 {
+			t.Fatalf("expected up to 3 concurrent fetches, got %d", n)
+		}
+
+		all, err := td.FetchTokenLists(ctx, mustFetchIndex(t, td))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(all[1]) != 4 || all[1][3].Name != "mainnet list3.json" || all[137][0].Name != "polygon list0.json" {
+			t.Fatalf("unexpected token lists: %+v", all)
+		}
+	})
+
+	t.Run("first failure cancels the rest", func(t *testing.T) {
+		server, _ := newServer("/mainnet/list0.json")
+		defer server.Close()
+
+		td := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(server.URL, nil)}, MaxConcurrency: 1})
+		_, err := td.FetchTokenLists(ctx, mustFetchIndex(t, td))
+		if err == nil || !strings.Contains(err.Error(), "list0.json") {
+			t.Fatalf("expected the failure to be reported, got: %v", err)
+		}
+		if paths := server.requestPaths(); len(paths) != 2 {
+			t.Fatalf("expected no fetch after the failure, got %v", paths)
+		}
+	})
+
+	t.Run("collect all errors", func(t *testing.T) {
+		server, _ := newServer("/polygon/")
+		defer server.Close()
+
+		td := NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(server.URL, nil)}, CollectAllErrors: true})
+		_, err := td.FetchTokenLists(ctx, mustFetchIndex(t, td))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		for i := range 4 {
+			if file := fmt.Sprintf("polygon/list%d.json", i); !strings.Contains(err.Error(), file) {
+				t.Fatalf("expected the failure of %s to be reported, got: %v", file, err)
+			}
+		}
+	})
+}
+
+func mustFetchIndex(t *testing.T, td *TokenDirectory) TokenDirectoryIndex {
+	t.Helper()
+	index, err := td.FetchIndex(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return index
+}
+
+func TestPartialResults(t *testing.T) {
+	ctx := context.Background()
+
+	good := testTokenListJSON
+	tampered := `{"name":"Tampered","chainId":1,"tokens":[]}`
+	indexJSON := fmt.Sprintf(`{"index":{
+		"mainnet":{"chainId":1,"tokenLists":{"erc20.json":%q,"erc721.json":%q}},
+		"_external":{"chainId":0,"tokenLists":{"broken.json":%q}}
+	}}`, sha256Hash([]byte(good)), sha256Hash([]byte(`{"name":"NFTs","tokens":[]}`)), sha256Hash([]byte("{}")))
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.json":
+			_, _ = w.Write([]byte(indexJSON))
+		case "/mainnet/erc20.json":
+			_, _ = w.Write([]byte(good))
+		case "/mainnet/erc721.json":
+			_, _ = w.Write([]byte(tampered))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+	primary := newHandlerTestServer(t, handler)
+	defer primary.Close()
+	fallback := newHandlerTestServer(t, handler)
+	defer fallback.Close()
+
+	t.Run("disabled", func(t *testing.T) {
+		td := NewTokenDirectory(Options{Sources: testSources(primary, fallback)})
+		tokenLists, err := td.FetchTokenLists(ctx, mustFetchIndex(t, td))
+		if err == nil || tokenLists != nil {
+			t.Fatalf("expected the fetch to fail altogether, got %v, %v", tokenLists, err)
+		}
+		var partialErr *PartialError
+		if errors.As(err, &partialErr) {
+			t.Fatalf("did not expect a partial error, got: %v", err)
+		}
+	})
+
+	t.Run("token lists", func(t *testing.T) {
+		td := NewTokenDirectory(Options{Sources: testSources(primary, fallback), AllowPartialResults: true})
+		tokenLists, err := td.FetchTokenLists(ctx, mustFetchIndex(t, td))
+		var partialErr *PartialError
+		if !errors.As(err, &partialErr) {
+			t.Fatalf("expected a partial error, got: %v", err)
+		}
+		if len(tokenLists[1]) != 1 || tokenLists[1][0].Name != "Test List" || len(tokenLists[0]) != 0 {
+			t.Fatalf("expected the valid token list only, got %+v", tokenLists)
+		}
+		if len(partialErr.Failures) != 2 {
+			t.Fatalf("expected 2 failures, got %+v", partialErr.Failures)
+		}
+		broken, mismatch := partialErr.Failures[0], partialErr.Failures[1]
+		if !strings.HasSuffix(broken.URL, "/_external/broken.json") || broken.ChainID != 0 || broken.HashMismatch {
+			t.Fatalf("unexpected failure: %+v", broken)
+		}
+		if len(broken.SourceErrors) != 2 || !strings.Contains(broken.SourceErrors[0].Error(), "404") {
+			t.Fatalf("expected the error of both sources, got %v", broken.SourceErrors)
+		}
+		if !strings.HasSuffix(mismatch.URL, "/mainnet/erc721.json") || mismatch.ChainID != 1 || !mismatch.HashMismatch {
+			t.Fatalf("expected a hash mismatch, got: %+v", mismatch)
+		}
+	})
+
+	t.Run("contract info", func(t *testing.T) {
+		td := NewTokenDirectory(Options{Sources: testSources(primary, fallback), AllowPartialResults: true})
+		contractInfo, err := td.FetchTokenContractInfo(ctx, mustFetchIndex(t, td))
+		var partialErr *PartialError
+		if !errors.As(err, &partialErr) || len(partialErr.Failures) != 2 {
+			t.Fatalf("expected a partial error, got: %v", err)
+		}
+		if len(contractInfo[1]) != 1 || contractInfo[1][0].Symbol != "ETH" {
+			t.Fatalf("expected the tokens of the valid token list, got %+v", contractInfo)
+		}
+	})
+}
+
+func TestTokenStandards(t *testing.T) {
+	ctx := context.Background()
+	dir := newTestDirectory(map[string]string{
+		"1/erc20.json":   testTokenList(1, testToken(1, "0x01", "USDC", "USD Coin")),
+		"1/erc721.json":  testTokenList(1, `{"chainId":1,"address":"0x02","name":"Punks","type":"ERC721"}`),
+		"1/erc1155.json": testTokenList(1, `{"chainId":1,"address":"0x03","name":"Items","type":"ERC1155"}`),
+		"_external/mixed.json": testTokenList(0,
+			testToken(1, "0x04", "DAI", "Dai"),
+			`{"chainId":1,"address":"0x05","name":"Apes","type":"ERC721"}`,
+		),
+	})
+	server := newHandlerTestServer(t, dir.handler)
+	defer server.Close()
+
+	td := NewTokenDirectory(Options{
+		Sources:        []Source{NewHTTPSource(server.URL, nil)},
+		TokenStandards: []TokenStandard{TokenStandardERC721},
+	})
+	index := mustFetchIndex(t, td)
+	if len(index[1]) != 1 || index[1][0].Filename != "erc721.json" || len(index[0]) != 1 {
+		t.Fatalf("expected the erc721 and external token lists only, got %+v", index)
+	}
+
+	contractInfo, err := td.FetchTokenContractInfo(ctx, index)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var addresses []string
+	for _, ci := range contractInfo[1] {
+		if ci.Type != TokenStandardERC721 {
+			t.Fatalf("unexpected token standard: %+v", ci)
+		}
+		addresses = append(addresses, ci.Address)
+	}
+	slices.Sort(addresses)
+	if !slices.Equal(addresses, []string{"0x02", "0x05"}) {
+		t.Fatalf("expected the ERC721 tokens only, got %v", addresses)
+	}
+
+	// untyped tokens keep the token standard of their list once merged
+	tokenList := TokenList{TokenStandard: TokenStandardERC721, Tokens: []ContractInfo{{Address: "0x06"}, {Address: "0x07", Type: TokenStandardERC1155}}}
+	normalizeTokenList(&tokenList)
+	if tokenList.Tokens[0].Type != TokenStandardERC721 || tokenList.Tokens[1].Type != TokenStandardERC1155 {
+		t.Fatalf("unexpected token standards: %+v", tokenList.Tokens)
+	}
+}
@@ -0,0 +1,222 @@
+package tokendirectory
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// SchemaValidation is the mode of validation of the token lists against
+// the Uniswap token list schema, see Options.SchemaValidation.
+type SchemaValidation int
+
+const (
+	// SchemaValidationOff does not validate the token lists.
+	SchemaValidationOff SchemaValidation = iota
+
+	// SchemaValidationReport reports the violations of each token list in
+	// TokenList.SchemaViolations.
+	SchemaValidationReport
+
+	// SchemaValidationReject rejects the token lists with violations, so
+	// they are fetched from the next source instead.
+	SchemaValidationReject
+)
+
+// limits of the Uniswap token list schema
+const (
+	maxTokenNameLength   = 60
+	maxTokenSymbolLength = 20
+	maxDecimals          = 255
+)
+
+var addressPattern = regexp.MustCompile(`^0x[a-fA-F0-9]{40}$`)
+
+// SchemaViolation is a violation of the Uniswap token list schema.
+type SchemaViolation struct {
+	// Token is the position of the token in the list, or -1 if the
+	// violation is about the list itself.
+	Token int
+
+	// Address is the address of the token, as found in the list.
+	Address string
+
+	// Field is the JSON field in violation, eg. "decimals".
+	Field string
+
+	Message string
+}
+
+func (v SchemaViolation) Error() string {
+	if v.Token < 0 {
+		return fmt.Sprintf("%s: %s", v.Field, v.Message)
+	}
+	return fmt.Sprintf("tokens[%d] (%s): %s: %s", v.Token, v.Address, v.Field, v.Message)
+}
+
+// SchemaError is reported (wrapped in a *ValidationError) when a token list
+// violates the Uniswap token list schema with SchemaValidationReject.
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	if len(e.Violations) == 1 {
+		return fmt.Sprintf("token list schema violation: %v", e.Violations[0])
+	}
+	return fmt.Sprintf("%d token list schema violations, first: %v", len(e.Violations), e.Violations[0])
+}
+
+func (e *SchemaError) Unwrap() []error {
+	errs := make([]error, len(e.Violations))
+	for i, violation := range e.Violations {
+		errs[i] = violation
+	}
+	return errs
+}
+
+// ValidateTokenList checks the token list against the Uniswap token list
+// schema: the required fields, the address format, the decimals range of
+// ERC20 tokens, the name and symbol lengths, and the logoURI schemes. It
+// returns the violations found, if any.
+func ValidateTokenList(tokenList TokenList) []SchemaViolation {
+	var violations []SchemaViolation
+	listViolation := func(field, message string) {
+		violations = append(violations, SchemaViolation{Token: -1, Field: field, Message: message})
+	}
+
+	if strings.TrimSpace(tokenList.Name) == "" {
+		listViolation("name", "is required")
+	}
+	if tokenList.Timestamp == nil {
+		listViolation("timestamp", "is required")
+	}
+	if tokenList.Version == nil {
+		listViolation("version", "is required")
+	}
+	if tokenList.Tokens == nil {
+		listViolation("tokens", "is required")
+	}
+	if tokenList.LogoURI != "" && !validLogoURI(tokenList.LogoURI) {
+		listViolation("logoURI", fmt.Sprintf("unsupported URI %q", tokenList.LogoURI))
+	}
+
+	for i, token := range tokenList.Tokens {
+		violation := func(field, message string) {
+			violations = append(violations, SchemaViolation{Token: i, Address: token.Address, Field: field, Message: message})
+		}
+
+		if token.ChainID == 0 {
+			violation("chainId", "is required")
+		}
+		if token.Address == "" {
+			violation("address", "is required")
+		} else if !addressPattern.MatchString(token.Address) {
+			violation("address", "is not a 0x-prefixed 20 bytes hex address")
+		}
+
+		// decimals only make sense for fungible tokens
+		if hasDecimals(token, tokenList) {
+			if token.Decimals == nil {
+				violation("decimals", "is required")
+			} else if *token.Decimals > maxDecimals {
+				violation("decimals", fmt.Sprintf("%d is out of the 0-%d range", *token.Decimals, maxDecimals))
+			}
+		}
+
+		if token.Name == "" {
+			violation("name", "is required")
+		} else if n := utf8.RuneCountInString(token.Name); n > maxTokenNameLength {
+			violation("name", fmt.Sprintf("is %d characters long, more than %d", n, maxTokenNameLength))
+		}
+		if token.Symbol == "" {
+			violation("symbol", "is required")
+		} else if n := utf8.RuneCountInString(token.Symbol); n > maxTokenSymbolLength {
+			violation("symbol", fmt.Sprintf("is %d characters long, more than %d", n, maxTokenSymbolLength))
+		} else if strings.ContainsFunc(token.Symbol, func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' }) {
+			violation("symbol", "contains whitespace")
+		}
+
+		if token.LogoURI != "" && !validLogoURI(token.LogoURI) {
+			violation("logoURI", fmt.Sprintf("unsupported URI %q", token.LogoURI))
+		}
+	}
+	return violations
+}
+
+// hasDecimals reports whether the token is fungible, and so must have
+// decimals.
+func hasDecimals(token ContractInfo, tokenList TokenList) bool {
+	return strings.EqualFold(string(tokenStandardOf(token, tokenList)), string(TokenStandardERC20))
+}
+
+// validLogoURI reports whether the URI is an http(s) or ipfs URI.
+func validLogoURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "https", "http":
+		return u.Host != ""
+	case "ipfs":
+		return u.Host != "" || u.Opaque != "" || u.Path != ""
+	default:
+		return false
+	}
+}
+
+// checkSchema validates the token list according to
+// Options.SchemaValidation, returning a *SchemaError for the token lists to
+// reject, and recording the violations of the token lists to report.
+func (d *TokenDirectory) checkSchema(tokenList *TokenList) error {
+	if d.options.SchemaValidation == SchemaValidationOff {
+		return nil
+	}
+
+	violations := ValidateTokenList(*tokenList)
+	if d.options.VerifyChecksums {
+		violations = append(violations, VerifyChecksums(*tokenList)...)
+		slices.SortStableFunc(violations, func(a, b SchemaViolation) int {
+			return cmp.Compare(a.Token, b.Token)
+		})
+	}
+
+	if d.options.SchemaValidation == SchemaValidationReject && len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	// a non-nil slice records the token list was validated
+	tokenList.SchemaViolations = violations
+	if tokenList.SchemaViolations == nil {
+		tokenList.SchemaViolations = []SchemaViolation{}
+	}
+	return nil
+}
+
+var errChecksumsNotVerifiable = errors.New("the checksums of the cached token list cannot be verified")
+
+// checkCachedSchema validates a token list served from the cache, which may
+// be shared with instances using other options, or be a serialized store
+// dropping the violations found. An error means the token list is to be
+// treated as a cache miss.
+func (d *TokenDirectory) checkCachedSchema(tokenList *TokenList) error {
+	switch {
+	case d.options.SchemaValidation == SchemaValidationOff:
+		return nil
+	case tokenList.SchemaViolations == nil && d.options.VerifyChecksums:
+		// the addresses were lowercased before the token list was cached,
+		// so their checksums cannot be verified again
+		return errChecksumsNotVerifiable
+	case tokenList.SchemaViolations == nil:
+		// the token list was not validated, or its violations were lost
+		return d.checkSchema(tokenList)
+	case d.options.SchemaValidation == SchemaValidationReject && len(tokenList.SchemaViolations) > 0:
+		return &SchemaError{Violations: tokenList.SchemaViolations}
+	}
+	return nil
+}
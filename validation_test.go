@@ -0,0 +1,135 @@
+package tokendirectory
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestValidateTokenList(t *testing.T) {
+	decimals := func(d uint64) *uint64 { return &d }
+	tokenList := TokenList{
+		Name:    "Test",
+		LogoURI: "ftp://example.com/logo.png",
+		Tokens: []ContractInfo{
+			{ChainID: 1, Address: "0x0000000000000000000000000000000000000001", Name: "Valid", Symbol: "OK", Decimals: decimals(18), LogoURI: "ipfs://QmHash"},
+			{ChainID: 1, Address: "0x123", Name: "Bad Address", Symbol: "ADDR", Decimals: decimals(18)},
+			{ChainID: 1, Address: "0x0000000000000000000000000000000000000002", Name: "No Decimals", Symbol: "DEC"},
+			{ChainID: 1, Address: "0x0000000000000000000000000000000000000003", Name: "Big Decimals", Symbol: "DEC", Decimals: decimals(256)},
+			{Address: "0x0000000000000000000000000000000000000004", Name: "A Name Which Is Far Too Long To Fit In The Sixty Characters Allowed", Symbol: "TWO WORDS", Decimals: decimals(0), LogoURI: "data:image/png;base64,AAAA"},
+			{ChainID: 1, Address: "0x0000000000000000000000000000000000000005", Type: TokenStandardERC721, Name: "NFT", Symbol: "NFT"},
+		},
+	}
+	type violation struct {
+		token int
+		field string
+	}
+	var got []violation
+	for _, v := range ValidateTokenList(tokenList) {
+		got = append(got, violation{v.Token, v.Field})
+	}
+	want := []violation{
+		{-1, "timestamp"},
+		{-1, "version"},
+		{-1, "logoURI"},
+		{1, "address"},
+		{2, "decimals"},
+		{3, "decimals"},
+		{4, "chainId"},
+		{4, "name"},
+		{4, "symbol"},
+		{4, "logoURI"},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected violations %v, got %v", want, got)
+	}
+}
+
+func TestSchemaValidation(t *testing.T) {
+	ctx := context.Background()
+	invalid := `{"name":"Invalid","chainId":1,"timestamp":"2024-01-01T00:00:00Z","version":{"major":1,"minor":0,"patch":0},"tokens":[{"chainId":1,"address":"0x00","name":"Ether","symbol":"ETH","decimals":18}]}`
+	indexJSON := `{"index":{"mainnet":{"chainId":1,"tokenLists":{"erc20.json":"` + sha256Hash([]byte(invalid)) + `"}}}}`
+	handler := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/index.json" {
+				_, _ = w.Write([]byte(indexJSON))
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		}
+	}
+	primary := newHandlerTestServer(t, handler(invalid))
+	defer primary.Close()
+	fallback := newHandlerTestServer(t, handler(invalid))
+	defer fallback.Close()
+
+	t.Run("off", func(t *testing.T) {
+		td := NewTokenDirectory(Options{Sources: testSources(primary, fallback)})
+		tokenList, err := td.FetchTokenList(ctx, td.TokenListURL("mainnet", "erc20.json"))
+		if err != nil || tokenList.SchemaViolations != nil {
+			t.Fatalf("expected no validation, got %v, %v", tokenList.SchemaViolations, err)
+		}
+	})
+
+	t.Run("report", func(t *testing.T) {
+		td := NewTokenDirectory(Options{Sources: testSources(primary, fallback), SchemaValidation: SchemaValidationReport})
+		for range 2 {
+			// the second fetch is served from the cache
+			tokenList, err := td.FetchTokenList(ctx, td.TokenListURL("mainnet", "erc20.json"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tokenList.SchemaViolations) != 1 || tokenList.SchemaViolations[0].Field != "address" {
+				t.Fatalf("expected the address to be reported, got %+v", tokenList.SchemaViolations)
+			}
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		td := NewTokenDirectory(Options{Sources: testSources(primary, fallback), SchemaValidation: SchemaValidationReject})
+		_, err := td.FetchTokenList(ctx, td.TokenListURL("mainnet", "erc20.json"))
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) || len(schemaErr.Violations) != 1 {
+			t.Fatalf("expected a schema error, got: %v", err)
+		}
+		if len(sourceErrors(err)) != 2 {
+			t.Fatalf("expected both sources to be tried, got: %v", err)
+		}
+		var violation SchemaViolation
+		if !errors.As(err, &violation) || violation.Token != 0 || violation.Field != "address" {
+			t.Fatalf("expected the violation to be inspectable, got %+v", violation)
+		}
+	})
+
+	t.Run("reject from a shared cache", func(t *testing.T) {
+		for _, mode := range []SchemaValidation{SchemaValidationOff, SchemaValidationReport} {
+			cache := NewMemoryCache()
+			writer := NewTokenDirectory(Options{Sources: testSources(primary, fallback), Cache: cache, SchemaValidation: mode})
+			if _, err := writer.FetchTokenList(ctx, writer.TokenListURL("mainnet", "erc20.json")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			td := NewTokenDirectory(Options{Sources: testSources(primary, fallback), Cache: cache, SchemaValidation: SchemaValidationReject})
+			tokenList, err := td.FetchTokenList(ctx, td.TokenListURL("mainnet", "erc20.json"))
+			if !errors.As(err, new(*SchemaError)) {
+				t.Fatalf("expected the token list cached with validation %v to be rejected, got %q: %v", mode, tokenList.Name, err)
+			}
+		}
+	})
+
+	t.Run("reject from a shared cache dir", func(t *testing.T) {
+		dir := t.TempDir()
+		writer := NewTokenDirectory(Options{Sources: testSources(primary, fallback), CacheDir: dir})
+		if _, err := writer.FetchTokenList(ctx, writer.TokenListURL("mainnet", "erc20.json")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		td := NewTokenDirectory(Options{Sources: testSources(primary, fallback), CacheDir: dir, SchemaValidation: SchemaValidationReject})
+		_, err := td.FetchTokenList(ctx, td.TokenListURL("mainnet", "erc20.json"))
+		if !errors.As(err, new(*SchemaError)) {
+			t.Fatalf("expected the cached token list to be rejected, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package tokendirectory
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the version of a token list. Token lists following the
+// Uniswap token list schema give it as an object, eg.
+// {"major":1,"minor":2,"patch":3}, while others give it as a semver string,
+// eg. "1.2.3", "v1.2.3" or "1.2.3-beta.1+build". Both forms are decoded,
+// and it is encoded as an object.
+type Version struct {
+	Major uint64 `json:"major"`
+	Minor uint64 `json:"minor"`
+	Patch uint64 `json:"patch"`
+
+	// PreRelease is the pre-release of a semver string, eg. "beta.1". It
+	// has no place in the object form, so it is not encoded.
+	PreRelease string `json:"-"`
+}
+
+// ParseVersion parses a semver string such as "1.2.3" or "v1.2.3", with an
+// optional pre-release and build metadata, eg. "1.2.3-beta.1+build". The
+// minor and patch numbers may be omitted, eg. "v2", and default to 0. The
+// build metadata does not take part in comparisons, so it is dropped.
+func ParseVersion(s string) (Version, error) {
+	core := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	core, build, hasBuild := strings.Cut(core, "+")
+	core, preRelease, hasPreRelease := strings.Cut(core, "-")
+	if (hasBuild && !validSemverIdentifiers(build)) || (hasPreRelease && !validSemverIdentifiers(preRelease)) {
+		return Version{}, fmt.Errorf("tokendirectory: invalid version %q", s)
+	}
+
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("tokendirectory: invalid version %q", s)
+	}
+	var numbers [3]uint64
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return Version{}, fmt.Errorf("tokendirectory: invalid version %q", s)
+		}
+		numbers[i] = n
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2], PreRelease: preRelease}, nil
+}
+
+// validSemverIdentifiers reports whether s is a dot-separated list of
+// non-empty alphanumeric identifiers, as in semver pre-releases and build
+// metadata.
+func validSemverIdentifiers(s string) bool {
+	for _, identifier := range strings.Split(s, ".") {
+		if identifier == "" || strings.ContainsFunc(identifier, func(r rune) bool {
+			return !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-')
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+func (v Version) String() string {
+	if v.PreRelease != "" {
+		return fmt.Sprintf("%d.%d.%d-%s", v.Major, v.Minor, v.Patch, v.PreRelease)
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1 if v is lower than other, 1 if it is higher, and 0 if
+// both versions are equal, following the semver precedence: a pre-release
+// is lower than its release.
+func (v Version) Compare(other Version) int {
+	if c := cmp.Compare(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+	return comparePreReleases(v.PreRelease, other.PreRelease)
+}
+
+// Less reports whether v is lower than other.
+func (v Version) Less(other Version) bool {
+	return v.Compare(other) < 0
+}
+
+// comparePreReleases compares two semver pre-releases identifier by
+// identifier: numeric identifiers compare numerically and are lower than
+// alphanumeric ones, which compare lexically.
+func comparePreReleases(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range min(len(as), len(bs)) {
+		an, aErr := strconv.ParseUint(as[i], 10, 64)
+		bn, bErr := strconv.ParseUint(bs[i], 10, 64)
+		var c int
+		switch {
+		case aErr == nil && bErr == nil:
+			c = cmp.Compare(an, bn)
+		case aErr == nil:
+			c = -1
+		case bErr == nil:
+			c = 1
+		default:
+			c = strings.Compare(as[i], bs[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
+}
+
+func (v *Version) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		version, err := ParseVersion(s)
+		if err != nil {
+			return err
+		}
+		*v = version
+		return nil
+	}
+
+	// decode the object form without recursing into UnmarshalJSON
+	type version Version
+	var object version
+	if err := json.Unmarshal(data, &object); err != nil {
+		return fmt.Errorf("tokendirectory: invalid version %s: %w", data, err)
+	}
+	*v = Version(object)
+	return nil
+}
+
+// UnmarshalJSON decodes the token list, leaving its Version nil when it is
+// missing or in a form which is not supported, rather than failing: the
+// version is informational, and not worth rejecting the token list for.
+func (t *TokenList) UnmarshalJSON(data []byte) error {
+	type tokenList TokenList
+	var decoded struct {
+		tokenList
+		Version json.RawMessage `json:"version"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*t = TokenList(decoded.tokenList)
+	t.Version = nil
+	if len(decoded.Version) > 0 {
+		var version Version
+		if err := json.Unmarshal(decoded.Version, &version); err == nil && !bytes.Equal(decoded.Version, []byte("null")) {
+			t.Version = &version
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package tokendirectory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestVersion(t *testing.T) {
+	for input, want := range map[string]Version{
+		`{"major":1,"minor":2,"patch":3}`: {Major: 1, Minor: 2, Patch: 3},
+		`{"major":4}`:                     {Major: 4},
+		`"1.2.3"`:                         {Major: 1, Minor: 2, Patch: 3},
+		`"v10.0.1"`:                       {Major: 10, Patch: 1},
+		`"2"`:                             {Major: 2},
+		`"1.2.3-beta.1"`:                  {Major: 1, Minor: 2, Patch: 3, PreRelease: "beta.1"},
+		`"1.0.0+build.5"`:                 {Major: 1},
+		`"v1.0.0-rc-1+sha.5114f85"`:       {Major: 1, PreRelease: "rc-1"},
+	} {
+		var got Version
+		if err := json.Unmarshal([]byte(input), &got); err != nil {
+			t.Fatalf("unexpected error for %s: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("expected %v for %s, got %v", want, input, got)
+		}
+	}
+	for _, input := range []string{`"1.2.3.4"`, `"1.x"`, `"latest"`, `""`, `"1.0.0-"`, `"1.0.0-beta..1"`, `[1,2,3]`} {
+		var v Version
+		if err := json.Unmarshal([]byte(input), &v); err == nil {
+			t.Fatalf("expected an error for %s", input)
+		}
+	}
+
+	buf, err := json.Marshal(Version{Major: 1, Minor: 2, Patch: 3, PreRelease: "beta"})
+	if err != nil || string(buf) != `{"major":1,"minor":2,"patch":3}` {
+		t.Fatalf("unexpected encoding: %s %v", buf, err)
+	}
+
+	// each version is lower than the next one
+	ordered := []string{"0.9.9", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.2.3", "1.3.0"}
+	for i := range ordered[1:] {
+		v, _ := ParseVersion(ordered[i])
+		next, _ := ParseVersion(ordered[i+1])
+		if !v.Less(next) || next.Less(v) || v.Compare(v) != 0 {
+			t.Fatalf("expected %s to be lower than %s", v, next)
+		}
+	}
+	if v, _ := ParseVersion("v1.2.3-rc.1+build"); v.String() != "1.2.3-rc.1" {
+		t.Fatalf("unexpected string: %s", v)
+	}
+}
+
+func TestTokenListVersion(t *testing.T) {
+	for input, want := range map[string]*Version{
+		`{"major":1,"minor":2,"patch":3}`: {Major: 1, Minor: 2, Patch: 3},
+		`"1.2.3-beta"`:                    {Major: 1, Minor: 2, Patch: 3, PreRelease: "beta"},
+		`"1.0.0+build"`:                   {Major: 1},
+		`null`:                            nil,
+		`1`:                               nil,
+		`"latest"`:                        nil,
+		`{"major":"one"}`:                 nil,
+	} {
+		// unsupported versions do not fail the token list
+		var tokenList TokenList
+		err := json.Unmarshal([]byte(`{"name":"Test","chainId":1,"version":`+input+`,"tokens":[{"chainId":1,"address":"0x01"}]}`), &tokenList)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", input, err)
+		}
+		if (tokenList.Version == nil) != (want == nil) || (want != nil && *tokenList.Version != *want) {
+			t.Fatalf("expected version %v for %s, got %v", want, input, tokenList.Version)
+		}
+		if tokenList.Name != "Test" || tokenList.ChainID != 1 || len(tokenList.Tokens) != 1 {
+			t.Fatalf("unexpected token list for %s: %+v", input, tokenList)
+		}
+	}
+
+	var tokenList TokenList
+	if err := json.Unmarshal([]byte(`{"name":"Test","tokens":[]}`), &tokenList); err != nil || tokenList.Version != nil {
+		t.Fatalf("expected no version, got %v %v", tokenList.Version, err)
+	}
+}
+
+func TestRejectVersionDowngrades(t *testing.T) {
+	ctx := context.Background()
+	versioned := func(version string) string {
+		return fmt.Sprintf(`{"name":"Test","chainId":1,"version":%s,"tokens":[]}`, version)
+	}
+
+	dir := newTestDirectory(map[string]string{"1/erc20.json": versioned(`"1.2.0"`)})
+	server := newHandlerTestServer(t, dir.handler)
+	defer server.Close()
+
+	td := NewTokenDirectory(Options{
+		Sources:                 []Source{NewHTTPSource(server.URL, nil)},
+		IndexTTL:                time.Nanosecond,
+		RejectVersionDowngrades: true,
+	})
+	tokenListURL := td.TokenListURL("1", "erc20.json")
+	tokenList, err := td.FetchTokenList(ctx, tokenListURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *tokenList.Version != (Version{Major: 1, Minor: 2, Patch: 0}) {
+		t.Fatalf("unexpected version: %v", tokenList.Version)
+	}
+
+	dir.set("1/erc20.json", versioned(`{"major":1,"minor":1,"patch":9}`))
+	_, err = td.FetchTokenList(ctx, tokenListURL)
+	var downgradeErr *VersionDowngradeError
+	if !errors.As(err, &downgradeErr) {
+		t.Fatalf("expected a *VersionDowngradeError, got: %v", err)
+	}
+	if downgradeErr.Cached != (Version{Major: 1, Minor: 2, Patch: 0}) || downgradeErr.Got != (Version{Major: 1, Minor: 1, Patch: 9}) || downgradeErr.URL != tokenListURL {
+		t.Fatalf("unexpected error: %+v", downgradeErr)
+	}
+
+	dir.set("1/erc20.json", versioned(`"v1.3.0"`))
+	if tokenList, err = td.FetchTokenList(ctx, tokenListURL); err != nil || *tokenList.Version != (Version{Major: 1, Minor: 3, Patch: 0}) {
+		t.Fatalf("expected the upgrade to be accepted, got %v: %v", tokenList.Version, err)
+	}
+
+	// a rolled back token list is a downgrade as well, even when it is
+	// still cached by a store shared between processes
+	rollback := func(t *testing.T, td, other *TokenDirectory) {
+		t.Helper()
+		dir.set("1/erc20.json", versioned(`"1.3.0"`))
+		if _, err := td.FetchTokenList(ctx, tokenListURL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// another process without the option caches the rolled back token
+		// list
+		dir.set("1/erc20.json", versioned(`"1.2.0"`))
+		if _, err := other.FetchTokenList(ctx, tokenListURL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := td.FetchTokenList(ctx, tokenListURL); !errors.As(err, new(*VersionDowngradeError)) {
+			t.Fatalf("expected a *VersionDowngradeError, got: %v", err)
+		}
+	}
+	t.Run("shared cache", func(t *testing.T) {
+		cache := newRemoteCache()
+		options := Options{Sources: []Source{NewHTTPSource(server.URL, nil)}, IndexTTL: time.Nanosecond, Cache: cache}
+		other := NewTokenDirectory(options)
+		options.RejectVersionDowngrades = true
+		rollback(t, NewTokenDirectory(options), other)
+	})
+	t.Run("shared cache dir", func(t *testing.T) {
+		options := Options{Sources: []Source{NewHTTPSource(server.URL, nil)}, IndexTTL: time.Nanosecond, CacheDir: t.TempDir()}
+		other := NewTokenDirectory(options)
+		options.RejectVersionDowngrades = true
+		rollback(t, NewTokenDirectory(options), other)
+	})
+
+	// the snapshot does not serve a downgrade either
+	dir.set("1/erc20.json", versioned(`"2.0.0"`))
+	snapshotIndexJSON := `{"index":{"1":{"chainId":1,"tokenLists":{"erc20.json":"` + sha256Hash([]byte(versioned(`"1.0.0"`))) + `"}}}}`
+	td = NewTokenDirectory(Options{
+		Sources:                 []Source{NewHTTPSource(server.URL, nil)},
+		IndexTTL:                time.Nanosecond,
+		RejectVersionDowngrades: true,
+		Snapshot: NewFSSource(fstest.MapFS{
+			"index/index.json":   {Data: []byte(snapshotIndexJSON)},
+			"index/1/erc20.json": {Data: []byte(versioned(`"1.0.0"`))},
+		}),
+	})
+	if _, err := td.FetchTokenList(ctx, tokenListURL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir.set("1/erc20.json", versioned(`"1.5.0"`))
+	tokenList, err = td.FetchTokenList(ctx, tokenListURL)
+	if !errors.As(err, &downgradeErr) || !strings.Contains(err.Error(), "fetching snapshot fs://index/1/erc20.json: token list version downgrade") {
+		t.Fatalf("expected the snapshot downgrade to be rejected, got %v: %v", tokenList.Version, err)
+	}
+
+	// without the option, downgrades are accepted
+	td = NewTokenDirectory(Options{Sources: []Source{NewHTTPSource(server.URL, nil)}, IndexTTL: time.Nanosecond})
+	if _, err := td.FetchTokenList(ctx, tokenListURL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir.set("1/erc20.json", versioned(`"1.0.0"`))
+	if tokenList, err = td.FetchTokenList(ctx, tokenListURL); err != nil || *tokenList.Version != (Version{Major: 1, Minor: 0, Patch: 0}) {
+		t.Fatalf("expected the downgrade to be accepted, got %v: %v", tokenList.Version, err)
+	}
+}